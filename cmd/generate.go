@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/tfkhdyt/geminicommit/internal/container"
+)
+
+var (
+	patchPath       string
+	generateNoCache bool
+)
+
+// generateCmd represents the generate command
+var generateCmd = &cobra.Command{
+	Use:   "generate --from-patch <file|-> [clue]",
+	Short: "Generate a commit message for a patch",
+	Long: `Generate a commit message for an arbitrary unified diff, such as a mailed
+patch, without a repository or staged changes. The message is printed to
+stdout.`,
+	Args: cobra.MaximumNArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// The same keys are bound to the flags of the root command, so they
+		// are only bound to these ones when this command runs
+		cobra.CheckErr(viper.BindPFlag("message.convention", cmd.Flags().Lookup("convention")))
+		cobra.CheckErr(viper.BindPFlag("message.language", cmd.Flags().Lookup("lang")))
+		cobra.CheckErr(viper.BindPFlag("message.detail", cmd.Flags().Lookup("detail")))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if generateNoCache {
+			viper.Set("cache.enabled", false)
+		}
+
+		generateHandler, err := container.GetGenerateHandlerInstance()
+		cobra.CheckErr(err)
+		generateHandler.GenerateCommand(&patchPath)(cmd, args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(generateCmd)
+
+	generateCmd.Flags().
+		StringVar(&patchPath, "from-patch", "", "unified diff to describe, - to read it from stdin")
+	cobra.CheckErr(generateCmd.MarkFlagRequired("from-patch"))
+	generateCmd.Flags().
+		String("convention", "", "commit message convention: conventional, gitmoji, angular, kernel or free-form (default is message.convention from config)")
+	generateCmd.Flags().
+		String("lang", "", "language to write the commit message in, e.g. Indonesian (default is message.language from config, or English)")
+	generateCmd.Flags().
+		String("detail", "", "message detail level: subject, short, detailed or auto (default is message.detail from config, or auto)")
+	generateCmd.Flags().
+		BoolVar(&generateNoCache, "no-cache", false, "always generate a new message instead of reusing the one cached for the same patch")
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tfkhdyt/geminicommit/internal/container"
+)
+
+var (
+	historyLimit    int
+	historyAllRepos bool
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Browse and reuse previously generated commit messages",
+	Long: `Browse the commit messages generated in the current repository, including
+the ones of cancelled or interrupted sessions, and commit with or print one of
+them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		historyHandler, err := container.GetHistoryHandlerInstance()
+		cobra.CheckErr(err)
+		historyHandler.HistoryCommand(&historyLimit, &historyAllRepos)(cmd, args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().
+		IntVarP(&historyLimit, "limit", "n", 20, "number of sessions to list")
+	historyCmd.Flags().
+		BoolVar(&historyAllRepos, "all-repos", false, "list the sessions of every repository")
+}
@@ -18,7 +18,9 @@ import (
 var (
 	cfgFile     string
 	stageAll    bool
-	rootHandler = container.GetRootHandlerInstance()
+	interactive bool
+	noCache     bool
+	output      string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -29,7 +31,15 @@ var RootCmd = &cobra.Command{
 	Version: "0.0.10",
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
-	Run: rootHandler.RootCommand(&stageAll),
+	Run: func(cmd *cobra.Command, args []string) {
+		if noCache {
+			viper.Set("cache.enabled", false)
+		}
+
+		rootHandler, err := container.GetRootHandlerInstance()
+		cobra.CheckErr(err)
+		rootHandler.RootCommand(&stageAll, &interactive, &output)(cmd, args)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -45,6 +55,10 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.AddCommand(config.ConfigCmd)
 
+	viper.SetDefault("history.enabled", true)
+	viper.SetDefault("cache.enabled", true)
+	viper.SetDefault("diff.go_context", true)
+
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
@@ -53,6 +67,27 @@ func init() {
 		StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/geminicommit/config.toml)")
 	RootCmd.Flags().
 		BoolVarP(&stageAll, "all", "a", false, "stage all changes in tracked files (default is false)")
+	RootCmd.Flags().
+		BoolVarP(&interactive, "interactive", "i", false, "pick the files, untracked ones included, and hunks to stage before generating the message")
+	RootCmd.Flags().
+		Int("examples", 0, "number of recent commit messages to use as style examples (default is style.examples from config)")
+	cobra.CheckErr(viper.BindPFlag("style.examples", RootCmd.Flags().Lookup("examples")))
+	RootCmd.Flags().
+		BoolP("signoff", "s", false, "add a Signed-off-by trailer (default is trailers.signoff from config)")
+	cobra.CheckErr(viper.BindPFlag("trailers.signoff", RootCmd.Flags().Lookup("signoff")))
+	RootCmd.Flags().
+		String("convention", "", "commit message convention: conventional, gitmoji, angular, kernel or free-form (default is message.convention from config)")
+	cobra.CheckErr(viper.BindPFlag("message.convention", RootCmd.Flags().Lookup("convention")))
+	RootCmd.Flags().
+		String("lang", "", "language to write the commit message in, e.g. Indonesian (default is message.language from config, or English)")
+	cobra.CheckErr(viper.BindPFlag("message.language", RootCmd.Flags().Lookup("lang")))
+	RootCmd.Flags().
+		String("detail", "", "message detail level: subject, short, detailed or auto (default is message.detail from config, or auto)")
+	cobra.CheckErr(viper.BindPFlag("message.detail", RootCmd.Flags().Lookup("detail")))
+	RootCmd.Flags().
+		BoolVar(&noCache, "no-cache", false, "always generate a new message instead of reusing the one cached for the same changes")
+	RootCmd.Flags().
+		StringVarP(&output, "output", "o", "text", "output format: text, or json to commit the first message without review and print a JSON report")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,39 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tfkhdyt/geminicommit/internal/container"
+)
+
+var (
+	usageGroupBy string
+	usageDays    int
+)
+
+// usageCmd represents the usage command
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and cost",
+	Long: `Report the tokens used by generated commit messages and their cost, per day,
+repository or model. Costs are computed from the pricing list of the config
+file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		usageHandler, err := container.GetUsageHandlerInstance()
+		cobra.CheckErr(err)
+		usageHandler.UsageCommand(&usageGroupBy, &usageDays)(cmd, args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(usageCmd)
+
+	usageCmd.Flags().
+		StringVar(&usageGroupBy, "by", "day", "group usage by day, repo or model")
+	usageCmd.Flags().
+		IntVar(&usageDays, "days", 30, "number of days to report, 0 for all")
+}
@@ -1,25 +1,91 @@
 package container
 
 import (
+	"sync"
+
+	"github.com/spf13/viper"
+
 	"github.com/tfkhdyt/geminicommit/internal/delivery/cli/handler"
 	"github.com/tfkhdyt/geminicommit/internal/service"
 	"github.com/tfkhdyt/geminicommit/internal/usecase"
 )
 
 var (
-	rootHandler   *handler.RootHandler
-	rootUsecase   *usecase.RootUsecase
-	gitService    *service.GitService
-	geminiService *service.GeminiService
+	rootHandler     *handler.RootHandler
+	rootUsecase     *usecase.RootUsecase
+	historyHandler  *handler.HistoryHandler
+	historyUsecase  *usecase.HistoryUsecase
+	usageHandler    *handler.UsageHandler
+	generateHandler *handler.GenerateHandler
+	generateUsecase *usecase.GenerateUsecase
+	usageUsecase    *usecase.UsageUsecase
+	gitService      service.GitService
+	geminiService   *service.GeminiService
+	historyService  *service.HistoryService
+	usageService    *service.UsageService
+
+	initOnce sync.Once
+	initErr  error
 )
 
-func init() {
-	gitService = service.NewGitService()
-	geminiService = service.NewGeminiService()
-	rootUsecase = usecase.NewRootUsecase(gitService, geminiService)
+// initialize wires the dependencies on first use, once the config has been
+// read, since some of them (e.g. the git backend) are chosen from it.
+func initialize() {
+	gitService, initErr = service.NewGitService(viper.GetString("git.backend"))
+	if initErr != nil {
+		return
+	}
+
+	historyPath := viper.GetString("history.path")
+	if historyPath == "" {
+		if historyPath, initErr = service.DefaultHistoryPath(); initErr != nil {
+			return
+		}
+	}
+
+	cacheDir := viper.GetString("cache.path")
+	if cacheDir == "" {
+		if cacheDir, initErr = service.DefaultResponseCacheDir(); initErr != nil {
+			return
+		}
+	}
+
+	usagePath := viper.GetString("usage.path")
+	if usagePath == "" {
+		if usagePath, initErr = service.DefaultUsagePath(); initErr != nil {
+			return
+		}
+	}
+
+	geminiService = service.NewGeminiService(service.NewResponseCache(cacheDir))
+	historyService = service.NewHistoryService(historyPath)
+	usageService = service.NewUsageService(usagePath)
+	rootUsecase = usecase.NewRootUsecase(gitService, geminiService, historyService, usageService)
 	rootHandler = handler.NewRootHandler(rootUsecase)
+	historyUsecase = usecase.NewHistoryUsecase(gitService, historyService)
+	historyHandler = handler.NewHistoryHandler(historyUsecase)
+	usageUsecase = usecase.NewUsageUsecase(usageService)
+	usageHandler = handler.NewUsageHandler(usageUsecase)
+	generateUsecase = usecase.NewGenerateUsecase(geminiService, usageService)
+	generateHandler = handler.NewGenerateHandler(generateUsecase)
+}
+
+func GetRootHandlerInstance() (*handler.RootHandler, error) {
+	initOnce.Do(initialize)
+	return rootHandler, initErr
+}
+
+func GetHistoryHandlerInstance() (*handler.HistoryHandler, error) {
+	initOnce.Do(initialize)
+	return historyHandler, initErr
+}
+
+func GetUsageHandlerInstance() (*handler.UsageHandler, error) {
+	initOnce.Do(initialize)
+	return usageHandler, initErr
 }
 
-func GetRootHandlerInstance() *handler.RootHandler {
-	return rootHandler
+func GetGenerateHandlerInstance() (*handler.GenerateHandler, error) {
+	initOnce.Do(initialize)
+	return generateHandler, initErr
 }
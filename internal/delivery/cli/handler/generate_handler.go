@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tfkhdyt/geminicommit/internal/usecase"
+)
+
+type GenerateHandler struct {
+	useCase *usecase.GenerateUsecase
+}
+
+func NewGenerateHandler(useCase *usecase.GenerateUsecase) *GenerateHandler {
+	return &GenerateHandler{useCase}
+}
+
+func (g *GenerateHandler) GenerateCommand(
+	patchPath *string,
+) func(*cobra.Command, []string) {
+	return func(_ *cobra.Command, args []string) {
+		checkAPIKey()
+
+		var promptAddition *string
+		if len(args) > 0 {
+			promptAddition = &args[0]
+		}
+		err := g.useCase.GenerateCommand(*patchPath, promptAddition)
+		cobra.CheckErr(err)
+	}
+}
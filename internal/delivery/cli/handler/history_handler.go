@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tfkhdyt/geminicommit/internal/usecase"
+)
+
+type HistoryHandler struct {
+	useCase *usecase.HistoryUsecase
+}
+
+func NewHistoryHandler(useCase *usecase.HistoryUsecase) *HistoryHandler {
+	return &HistoryHandler{useCase}
+}
+
+func (h *HistoryHandler) HistoryCommand(
+	limit *int,
+	allRepos *bool,
+) func(*cobra.Command, []string) {
+	return func(_ *cobra.Command, _ []string) {
+		err := h.useCase.HistoryCommand(*limit, *allRepos)
+		cobra.CheckErr(err)
+	}
+}
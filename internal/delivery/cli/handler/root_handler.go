@@ -21,23 +21,35 @@ func NewRootHandler(useCase *usecase.RootUsecase) *RootHandler {
 
 func (r *RootHandler) RootCommand(
 	stageAll *bool,
+	interactive *bool,
+	output *string,
 ) func(*cobra.Command, []string) {
 	return func(_ *cobra.Command, args []string) {
-		if apiKey := viper.GetString("api.key"); apiKey == "" {
-			fmt.Println(
-				"Error: API key is still empty, run this command to set your API key",
-			)
-			fmt.Print("\n")
-			color.New(color.Bold).Print("geminicommit config key set ")
-			color.New(color.Italic, color.Bold).Print("api_key\n\n")
-			os.Exit(1)
+		// The JSON output reports a missing key in its own error document
+		if *output != usecase.OutputJSON {
+			checkAPIKey()
 		}
 
 		var promptAddition *string
 		if len(args) > 0 {
 			promptAddition = &args[0]
 		}
-		err := r.useCase.RootCommand(stageAll, promptAddition)
+		err := r.useCase.RootCommand(stageAll, interactive, promptAddition, *output)
 		cobra.CheckErr(err)
 	}
 }
+
+// checkAPIKey exits with instructions, printed to stderr, when no API key is
+// configured.
+func checkAPIKey() {
+	if apiKey := viper.GetString("api.key"); apiKey == "" {
+		fmt.Fprintln(
+			os.Stderr,
+			"Error: API key is still empty, run this command to set your API key",
+		)
+		fmt.Fprint(os.Stderr, "\n")
+		color.New(color.Bold).Fprint(os.Stderr, "geminicommit config key set ")
+		color.New(color.Italic, color.Bold).Fprint(os.Stderr, "api_key\n\n")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tfkhdyt/geminicommit/internal/usecase"
+)
+
+type UsageHandler struct {
+	useCase *usecase.UsageUsecase
+}
+
+func NewUsageHandler(useCase *usecase.UsageUsecase) *UsageHandler {
+	return &UsageHandler{useCase}
+}
+
+func (u *UsageHandler) UsageCommand(
+	groupBy *string,
+	days *int,
+) func(*cobra.Command, []string) {
+	return func(_ *cobra.Command, _ []string) {
+		err := u.useCase.UsageCommand(*groupBy, *days)
+		cobra.CheckErr(err)
+	}
+}
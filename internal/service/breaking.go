@@ -0,0 +1,396 @@
+package service
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// BreakingChangeKind is what a BreakingChange is about.
+type BreakingChangeKind string
+
+const (
+	BreakingRemovedSymbol BreakingChangeKind = "removed-symbol"
+	BreakingChangedSymbol BreakingChangeKind = "changed-signature"
+	BreakingRemovedFlag   BreakingChangeKind = "removed-flag"
+	BreakingDeletedFile   BreakingChangeKind = "deleted-file"
+)
+
+// BreakingChange is a probable breaking change found in the diff.
+type BreakingChange struct {
+	Kind BreakingChangeKind
+	Path string
+	// Name is the identifier, flag or file the change is about.
+	Name string
+}
+
+func (b BreakingChange) String() string {
+	switch b.Kind {
+	case BreakingRemovedSymbol:
+		return fmt.Sprintf("exported %s was removed or renamed (%s)", b.Name, b.Path)
+	case BreakingChangedSymbol:
+		return fmt.Sprintf("signature of exported %s changed (%s)", b.Name, b.Path)
+	case BreakingRemovedFlag:
+		return fmt.Sprintf("flag --%s was removed (%s)", b.Name, b.Path)
+	default:
+		return fmt.Sprintf("public file %s was deleted", b.Path)
+	}
+}
+
+var (
+	// goDeclaration matches the first line of top-level Go declarations, with
+	// the receiver type of methods.
+	goDeclaration = regexp.MustCompile(
+		`^(func|type|var|const)\s+(?:\(\s*(?:\w+\s+)?\*?([A-Za-z_]\w*)(?:\[[^\]]*\])?\s*\)\s*)?([A-Za-z_]\w*)`,
+	)
+	// goFlagDefinition matches flags defined with the flag or pflag
+	// packages, e.g. `StringVarP(&value, "name", "n", ...)`.
+	goFlagDefinition = regexp.MustCompile(
+		`\b(?:Bool|String|Int|Int64|Uint|Uint64|Float64|Duration|Count|StringSlice|StringArray|StringToString|IntSlice)(?:Var)?P?\(\s*(?:&[\w.]+\s*,\s*)?"([A-Za-z0-9][\w-]*)"`,
+	)
+	// publicFileExtensions are the extensions, besides Go files, of files
+	// other projects build against.
+	publicFileExtensions = []string{".h", ".hpp", ".proto"}
+)
+
+// goSymbolKey identifies an exported declaration of a package, e.g.
+// {"pkg/api", "func", "Client.Do"}.
+type goSymbolKey struct {
+	dir, kind, name string
+}
+
+// goSymbol is an exported declaration of the old or new side of the changed
+// files.
+type goSymbol struct {
+	path string
+	// signature holds the receiver, parameter and result types of a func,
+	// without names, or is empty when unknown.
+	signature string
+}
+
+// DetectBreakingChanges flags probable breaking changes from the diff:
+// exported Go identifiers that were removed or renamed or whose signature
+// changed, command line flags that were removed and public files that were
+// deleted. readBlob reads both sides of the Go files to compare their
+// declarations; when it is nil, as for patches, or a file does not parse,
+// only the changed lines of the file are looked at. It may both miss
+// changes and flag ones that break nothing, such as identifiers of a main
+// package.
+func DetectBreakingChanges(
+	changes *StagedChanges,
+	readBlob func(hash string) ([]byte, error),
+) []BreakingChange {
+	oldSymbols := make(map[goSymbolKey]goSymbol)
+	newSymbols := make(map[goSymbolKey]goSymbol)
+	var symbolOrder []goSymbolKey
+
+	parsed := make(map[string]bool)
+	if readBlob != nil {
+		for _, file := range changes.Files {
+			oldDecls, newDecls, ok := parseChangedGoFile(file, readBlob)
+			if !ok {
+				continue
+			}
+			parsed[file.Path] = true
+
+			oldPath := file.Path
+			if file.OldPath != "" {
+				oldPath = file.OldPath
+			}
+			for _, decl := range oldDecls {
+				key := goSymbolKey{path.Dir(oldPath), decl.kind, decl.name}
+				if _, ok := oldSymbols[key]; !ok {
+					oldSymbols[key] = goSymbol{oldPath, decl.signature}
+					symbolOrder = append(symbolOrder, key)
+				}
+			}
+			for _, decl := range newDecls {
+				key := goSymbolKey{path.Dir(file.Path), decl.kind, decl.name}
+				if _, ok := newSymbols[key]; !ok {
+					newSymbols[key] = goSymbol{file.Path, decl.signature}
+				}
+			}
+		}
+	}
+
+	removedFlags := make(map[string]string)
+	addedFlags := make(map[string]bool)
+	var flagOrder []string
+	forEachDiffLine(changes.Diff, func(file, line string) {
+		if !strings.HasSuffix(file, ".go") {
+			return
+		}
+
+		removed := strings.HasPrefix(line, "-")
+		code := line[1:]
+
+		for _, match := range goFlagDefinition.FindAllStringSubmatch(code, -1) {
+			if removed {
+				if _, ok := removedFlags[match[1]]; !ok {
+					removedFlags[match[1]] = file
+					flagOrder = append(flagOrder, match[1])
+				}
+			} else {
+				addedFlags[match[1]] = true
+			}
+		}
+
+		if parsed[file] || !isPublicGoFile(file) {
+			return
+		}
+		match := goDeclaration.FindStringSubmatch(code)
+		if match == nil || !isExported(match[3]) || (match[2] != "" && !isExported(match[2])) {
+			return
+		}
+
+		name := match[3]
+		if match[2] != "" {
+			name = match[2] + "." + name
+		}
+		key := goSymbolKey{path.Dir(file), match[1], name}
+		symbol := goSymbol{path: file}
+		if key.kind == "func" {
+			symbol.signature = parseFuncLine(code)
+		}
+		if removed {
+			if _, ok := oldSymbols[key]; !ok {
+				oldSymbols[key] = symbol
+				symbolOrder = append(symbolOrder, key)
+			}
+		} else if _, ok := newSymbols[key]; !ok {
+			newSymbols[key] = symbol
+		}
+	})
+
+	var found []BreakingChange
+	for _, key := range symbolOrder {
+		removed := oldSymbols[key]
+		name := key.kind + " " + key.name
+
+		added, ok := newSymbols[key]
+		switch {
+		case !ok:
+			found = append(found, BreakingChange{BreakingRemovedSymbol, removed.path, name})
+		case key.kind == "func" && removed.signature != "" && added.signature != "" &&
+			added.signature != removed.signature:
+			found = append(found, BreakingChange{BreakingChangedSymbol, added.path, name})
+		}
+	}
+
+	for _, flag := range flagOrder {
+		if !addedFlags[flag] {
+			found = append(found, BreakingChange{BreakingRemovedFlag, removedFlags[flag], flag})
+		}
+	}
+
+	for _, file := range changes.Files {
+		if file.Status == StatusDeleted && isPublicFile(file.Path) {
+			found = append(found, BreakingChange{Kind: BreakingDeletedFile, Path: file.Path})
+		}
+	}
+
+	return found
+}
+
+// goExportedDecl is an exported top-level declaration of a Go file.
+type goExportedDecl struct {
+	kind, name, signature string
+}
+
+// parseChangedGoFile parses the exported declarations of both sides of a
+// changed public Go file, reporting false when a side cannot be read or
+// parsed. The source side of copies is left out since it still exists, and
+// deleted files are reported as a whole.
+func parseChangedGoFile(
+	file FileChange,
+	readBlob func(hash string) ([]byte, error),
+) ([]goExportedDecl, []goExportedDecl, bool) {
+	if !isPublicGoFile(file.Path) || file.Summarized() || file.Status == StatusDeleted {
+		return nil, nil, false
+	}
+
+	parse := func(hash string) ([]goExportedDecl, bool) {
+		content, err := readBlob(hash)
+		if err != nil {
+			return nil, false
+		}
+		decls, err := parseExportedDecls(content)
+		return decls, err == nil
+	}
+
+	newDecls, ok := parse(file.NewHash)
+	if !ok {
+		return nil, nil, false
+	}
+	if file.OldHash == "" || file.Status == StatusCopied {
+		return nil, newDecls, true
+	}
+	oldDecls, ok := parse(file.OldHash)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return oldDecls, newDecls, true
+}
+
+// parseExportedDecls lists the exported top-level declarations of a Go file,
+// with the signature of funcs.
+func parseExportedDecls(src []byte) ([]goExportedDecl, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []goExportedDecl
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if !isExported(name) {
+				continue
+			}
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recv := receiverName(decl.Recv.List[0].Type)
+				if !isExported(recv) {
+					continue
+				}
+				name = recv + "." + name
+			}
+			decls = append(decls, goExportedDecl{"func", name, funcSignature(decl)})
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if isExported(spec.Name.Name) {
+						decls = append(decls, goExportedDecl{kind: "type", name: spec.Name.Name})
+					}
+				case *ast.ValueSpec:
+					for _, ident := range spec.Names {
+						if isExported(ident.Name) {
+							decls = append(decls, goExportedDecl{kind: decl.Tok.String(), name: ident.Name})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return decls, nil
+}
+
+// parseFuncLine returns the signature of a func declared on a single diff
+// line, with or without its body, or an empty string when the declaration
+// spans more lines.
+func parseFuncLine(code string) string {
+	for _, src := range []string{"package p\n" + code, "package p\n" + code + "\n}"} {
+		file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+		if err != nil || len(file.Decls) == 0 {
+			continue
+		}
+		if decl, ok := file.Decls[0].(*ast.FuncDecl); ok {
+			return funcSignature(decl)
+		}
+	}
+
+	return ""
+}
+
+// funcSignature renders the receiver, type parameter, parameter and result
+// types of a func, leaving out names and the body so that renaming a
+// parameter or editing the body does not change it.
+func funcSignature(decl *ast.FuncDecl) string {
+	var signature strings.Builder
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		recv := decl.Recv.List[0].Type
+		pointer := ""
+		if _, ok := recv.(*ast.StarExpr); ok {
+			pointer = "*"
+		}
+		fmt.Fprintf(&signature, "(%s%s) ", pointer, receiverName(recv))
+	}
+
+	signature.WriteString("func")
+	if decl.Type.TypeParams != nil {
+		fmt.Fprintf(&signature, "[%s]", fieldTypes(decl.Type.TypeParams))
+	}
+	fmt.Fprintf(&signature, "(%s)", fieldTypes(decl.Type.Params))
+	if decl.Type.Results != nil {
+		fmt.Fprintf(&signature, " (%s)", fieldTypes(decl.Type.Results))
+	}
+
+	return signature.String()
+}
+
+// fieldTypes renders the types of a field list, once per name.
+func fieldTypes(fields *ast.FieldList) string {
+	var list []string
+	for _, field := range fields.List {
+		fieldType := types.ExprString(field.Type)
+		for range max(len(field.Names), 1) {
+			list = append(list, fieldType)
+		}
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// DescribeBreakingChanges joins breaking changes into the description of a
+// BREAKING CHANGE footer.
+func DescribeBreakingChanges(found []BreakingChange) string {
+	descriptions := make([]string, 0, len(found))
+	for _, change := range found {
+		descriptions = append(descriptions, change.String())
+	}
+
+	description := strings.Join(descriptions, "; ")
+	if description == "" {
+		return ""
+	}
+
+	return strings.ToUpper(description[:1]) + description[1:] + "."
+}
+
+// forEachDiffLine calls fn with the added and removed lines of a diff and
+// the path of the file they belong to.
+func forEachDiffLine(diff string, fn func(file, line string)) {
+	var file string
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			file = patchPath(lines[i+1][4:], "b/")
+			if file == "" {
+				file = patchPath(line[4:], "a/")
+			}
+		case strings.HasPrefix(line, "+++ "):
+		case file != "" && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")):
+			fn(file, line)
+		}
+	}
+}
+
+// isPublicGoFile tells whether file is part of a package other modules can
+// import: not a test, internal, vendored or testdata file.
+func isPublicGoFile(file string) bool {
+	if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+		return false
+	}
+
+	return !slices.ContainsFunc(strings.Split(path.Dir(file), "/"), func(dir string) bool {
+		return dir == "internal" || dir == "vendor" || dir == "testdata"
+	})
+}
+
+func isPublicFile(file string) bool {
+	return isPublicGoFile(file) || slices.Contains(publicFileExtensions, path.Ext(file))
+}
+
+func isExported(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
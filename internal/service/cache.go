@@ -0,0 +1,107 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultCacheTTL is how long cached responses are reused, unless overridden
+// by `cache.ttl`.
+const defaultCacheTTL = 7 * 24 * time.Hour
+
+// ResponseCache stores generated messages on disk, one file per prompt, so
+// that running geminicommit again on the same changes does not pay for a new
+// generation.
+type ResponseCache struct {
+	dir string
+}
+
+func NewResponseCache(dir string) *ResponseCache {
+	return &ResponseCache{dir}
+}
+
+// DefaultResponseCacheDir returns the geminicommit directory of the user
+// cache directory.
+func DefaultResponseCacheDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cache, "geminicommit", "responses"), nil
+}
+
+// ResponseCacheKey identifies a generation by the model and the full prompt,
+// which holds the diff and every setting that shapes the message.
+func ResponseCacheKey(model, prompt string) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(prompt))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the message cached under key, if there is one younger than
+// `cache.ttl`.
+func (c *ResponseCache) Get(key string) (string, bool) {
+	path := filepath.Join(c.dir, key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+
+	if time.Since(info.ModTime()) > cacheTTL() {
+		_ = os.Remove(path)
+		return "", false
+	}
+
+	message, err := os.ReadFile(path)
+	if err != nil || len(message) == 0 {
+		return "", false
+	}
+
+	return string(message), true
+}
+
+// Put caches message under key.
+func (c *ResponseCache) Put(key, message string) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to make cache dir. %v", err)
+	}
+
+	// Written aside and renamed so that readers never see a partial file
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache. %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(message)
+	err = errors.Join(err, tmp.Close())
+	if err != nil {
+		return fmt.Errorf("failed to write cache. %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("failed to write cache. %v", err)
+	}
+
+	return nil
+}
+
+func cacheTTL() time.Duration {
+	if ttl := viper.GetDuration("cache.ttl"); ttl > 0 {
+		return ttl
+	}
+
+	return defaultCacheTTL
+}
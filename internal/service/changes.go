@@ -0,0 +1,361 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ChangeStatus is the kind of change git reports for a staged file, using the
+// same letters as `git diff --name-status`.
+type ChangeStatus string
+
+const (
+	StatusAdded       ChangeStatus = "A"
+	StatusModified    ChangeStatus = "M"
+	StatusDeleted     ChangeStatus = "D"
+	StatusRenamed     ChangeStatus = "R"
+	StatusCopied      ChangeStatus = "C"
+	StatusTypeChanged ChangeStatus = "T"
+)
+
+// submoduleMode is the git file mode of a submodule (gitlink) entry.
+const submoduleMode = "160000"
+
+// maxSubmoduleLogEntries bounds how many submodule commits are listed.
+const maxSubmoduleLogEntries = 50
+
+// FileKind classifies a staged file by whether its content is worth sending
+// to the model.
+type FileKind string
+
+const (
+	// KindText files are sent as a regular diff.
+	KindText       FileKind = ""
+	KindBinary     FileKind = "binary"
+	KindGenerated  FileKind = "generated"
+	KindMinified   FileKind = "minified"
+	KindVendored   FileKind = "vendored"
+	KindLFSPointer FileKind = "Git LFS pointer"
+	KindLarge      FileKind = "large"
+	// KindLockFile files match DefaultLockFilePatterns and are left out of
+	// the prompt entirely, see StagedChanges.LockFiles.
+	KindLockFile FileKind = "lock file"
+)
+
+// FileChange is a single staged file.
+type FileChange struct {
+	Status ChangeStatus
+	Path   string
+	// OldPath is the source path of a rename or copy.
+	OldPath string
+	// Similarity is the similarity index (0-100) of a rename or copy.
+	Similarity int
+	// OldMode and NewMode are git file modes such as "100644". They are
+	// empty for the side that does not exist (additions and deletions).
+	OldMode string
+	NewMode string
+	// OldHash and NewHash are the full object names of both sides.
+	OldHash string
+	NewHash string
+	// Kind tells whether the content is diffed or only summarized.
+	Kind FileKind
+	// OldSize and NewSize are the blob sizes in bytes of both sides.
+	OldSize int64
+	NewSize int64
+	// SizeKnown tells whether OldSize and NewSize were read from the blobs,
+	// which is not the case for changes read from a patch.
+	SizeKnown bool
+	// SubmoduleLog holds the `git log --oneline old..new` lines of a
+	// submodule whose pointer moved, newest first, at most
+	// maxSubmoduleLogEntries of them.
+	SubmoduleLog []string
+	// SubmoduleLogLoaded tells whether SubmoduleLog could be read, which
+	// needs the submodule to be checked out with both commits fetched.
+	SubmoduleLogLoaded bool
+	// SubmoduleLogCapped tells whether SubmoduleLog was cut at
+	// maxSubmoduleLogEntries.
+	SubmoduleLogCapped bool
+	// Symbols are the exported Go declarations the changes touch, set by
+	// EnrichGoContext.
+	Symbols []SymbolChange
+}
+
+// IsSubmodule reports whether the file is a submodule pointer.
+func (f FileChange) IsSubmodule() bool {
+	return f.NewMode == submoduleMode || (f.NewMode == "" && f.OldMode == submoduleMode)
+}
+
+// ModeChanged reports whether the file permissions or type changed.
+func (f FileChange) ModeChanged() bool {
+	return f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode
+}
+
+// Summarized reports whether the file content is left out of the diff.
+func (f FileChange) Summarized() bool {
+	return f.Kind != KindText
+}
+
+// SizeSummary describes the size change of the file, e.g.
+// "1.2 MiB -> 1.3 MiB (+100 KiB)".
+func (f FileChange) SizeSummary() string {
+	switch {
+	case f.OldMode == "":
+		return fmt.Sprintf("%s (new)", humanize.IBytes(uint64(f.NewSize)))
+	case f.NewMode == "":
+		return fmt.Sprintf("%s (removed)", humanize.IBytes(uint64(f.OldSize)))
+	}
+
+	delta := f.NewSize - f.OldSize
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+
+	return fmt.Sprintf(
+		"%s -> %s (%s%s)",
+		humanize.IBytes(uint64(f.OldSize)),
+		humanize.IBytes(uint64(f.NewSize)),
+		sign,
+		humanize.IBytes(uint64(delta)),
+	)
+}
+
+// StagedChanges describes everything that is about to be committed.
+type StagedChanges struct {
+	Files []FileChange
+	// Diff is the unified diff of every non-deleted, non-summarized file.
+	Diff string
+	// LockFiles are the staged files matching DefaultLockFilePatterns, which
+	// are kept out of Files and of the diff.
+	LockFiles []FileChange
+}
+
+// ChangedLines counts the added and removed lines of the diff.
+func (c *StagedChanges) ChangedLines() int {
+	added, removed := countChangedLines(c.Diff)
+	return added + removed
+}
+
+// Hash identifies the changes by the status, paths, modes and object names
+// of their files, so that detecting the same staged changes again, with or
+// without Go context, gives the same hash.
+func (c *StagedChanges) Hash() string {
+	h := sha256.New()
+	for _, file := range c.Files {
+		fmt.Fprintf(
+			h,
+			"%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\n",
+			file.Status,
+			file.OldPath,
+			file.Path,
+			file.OldMode,
+			file.NewMode,
+			file.OldHash,
+			file.NewHash,
+		)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileDiffs splits the diff per file, keyed by the new path of each file.
+func (c *StagedChanges) FileDiffs() map[string]string {
+	diffs := make(map[string]string)
+	var path string
+	var section strings.Builder
+	flush := func() {
+		if path != "" {
+			diffs[path] = section.String()
+		}
+		section.Reset()
+	}
+
+	lines := strings.Split(strings.TrimSuffix(c.Diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			_, path = parseDiffGitPaths(line)
+		case strings.HasPrefix(line, "+++ ") && i > 0 && strings.HasPrefix(lines[i-1], "--- "):
+			if newPath := patchPath(line[4:], "b/"); newPath != "" {
+				path = newPath
+			}
+		}
+		section.WriteString(line + "\n")
+	}
+	flush()
+
+	return diffs
+}
+
+// GoBlobHashes returns the object names of both sides of the diffed Go
+// files, whose declarations EnrichGoContext and DetectBreakingChanges read.
+func (c *StagedChanges) GoBlobHashes() []string {
+	var hashes []string
+	for _, file := range c.Files {
+		if !strings.HasSuffix(file.Path, ".go") || file.Status == StatusDeleted || file.Summarized() {
+			continue
+		}
+		if file.OldHash != "" {
+			hashes = append(hashes, file.OldHash)
+		}
+		hashes = append(hashes, file.NewHash)
+	}
+
+	return hashes
+}
+
+// BlobReader returns a function reading blobs from those read beforehand,
+// e.g. by GitService.ReadBlobs.
+func BlobReader(blobs map[string][]byte) func(hash string) ([]byte, error) {
+	return func(hash string) ([]byte, error) {
+		content, ok := blobs[hash]
+		if !ok {
+			return nil, fmt.Errorf("blob %s was not read", hash)
+		}
+
+		return content, nil
+	}
+}
+
+// DeletedFiles returns the paths of the deleted files.
+func (c *StagedChanges) DeletedFiles() []string {
+	var files []string
+	for _, file := range c.Files {
+		if file.Status == StatusDeleted {
+			files = append(files, file.Path)
+		}
+	}
+
+	return files
+}
+
+// Summary renders changed exported Go declarations, renames, copies, mode
+// changes, submodule updates and files left out of the diff as plain-text
+// context for the model, since those are hard to tell apart in (or missing
+// from) a raw diff.
+func (c *StagedChanges) Summary() string {
+	var renamed, copied, modes, summarized, submodules, symbols []string
+	for _, file := range c.Files {
+		if len(file.Symbols) > 0 {
+			described := make([]string, 0, len(file.Symbols))
+			for _, symbol := range file.Symbols {
+				described = append(described, symbol.String())
+			}
+			symbols = append(symbols, fmt.Sprintf("%s: %s", file.Path, strings.Join(described, ", ")))
+		}
+		if file.IsSubmodule() && file.Status != StatusDeleted {
+			submodules = append(submodules, describeSubmoduleUpdate(file))
+		}
+		if file.Summarized() && file.Status != StatusDeleted {
+			summary := fmt.Sprintf("%s: %s", file.Path, file.Kind)
+			if file.SizeKnown {
+				summary += ", " + file.SizeSummary()
+			}
+			summarized = append(summarized, summary)
+		}
+		switch file.Status {
+		case StatusRenamed:
+			renamed = append(
+				renamed,
+				fmt.Sprintf("%s -> %s (%d%% similar)", file.OldPath, file.Path, file.Similarity),
+			)
+		case StatusCopied:
+			copied = append(
+				copied,
+				fmt.Sprintf("%s -> %s (%d%% similar)", file.OldPath, file.Path, file.Similarity),
+			)
+		}
+		if file.ModeChanged() {
+			modes = append(
+				modes,
+				fmt.Sprintf("%s: %s -> %s", file.Path, DescribeMode(file.OldMode), DescribeMode(file.NewMode)),
+			)
+		}
+	}
+
+	var sb strings.Builder
+	if len(symbols) > 0 {
+		sb.WriteString("\n\nChanged exported Go declarations:\n" + strings.Join(symbols, "\n"))
+	}
+	if len(renamed) > 0 {
+		sb.WriteString("\n\nRenamed/moved files:\n" + strings.Join(renamed, "\n"))
+	}
+	if len(copied) > 0 {
+		sb.WriteString("\n\nCopied files:\n" + strings.Join(copied, "\n"))
+	}
+	if len(modes) > 0 {
+		sb.WriteString("\n\nPermission and type changes:\n" + strings.Join(modes, "\n"))
+	}
+	if len(submodules) > 0 {
+		sb.WriteString("\n\nSubmodule updates:\n" + strings.Join(submodules, "\n"))
+	}
+	if len(summarized) > 0 {
+		sb.WriteString(
+			"\n\nFiles changed but left out of the diff (kind, size change):\n" +
+				strings.Join(summarized, "\n"),
+		)
+	}
+
+	return sb.String()
+}
+
+func describeSubmoduleUpdate(file FileChange) string {
+	var header string
+	if file.OldHash == "" {
+		header = fmt.Sprintf("%s: added at %s", file.Path, ShortHash(file.NewHash))
+	} else {
+		header = fmt.Sprintf(
+			"%s: %s -> %s",
+			file.Path,
+			ShortHash(file.OldHash),
+			ShortHash(file.NewHash),
+		)
+	}
+
+	switch {
+	case !file.SubmoduleLogLoaded:
+		return header + " (commit log unavailable)"
+	case len(file.SubmoduleLog) == 0:
+		return header + " (no new commits, the submodule was rewound)"
+	case file.SubmoduleLogCapped:
+		return fmt.Sprintf(
+			"%s, latest %d commits (more omitted):\n  %s",
+			header,
+			len(file.SubmoduleLog),
+			strings.Join(file.SubmoduleLog, "\n  "),
+		)
+	}
+
+	return header + ", commits:\n  " + strings.Join(file.SubmoduleLog, "\n  ")
+}
+
+// ShortHash abbreviates an object name to 7 characters like git does.
+func ShortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+
+	return hash
+}
+
+// DescribeMode returns a human readable name for a git file mode.
+func DescribeMode(mode string) string {
+	switch mode {
+	case "100644":
+		return "regular file (100644)"
+	case "100755":
+		return "executable file (100755)"
+	case "120000":
+		return "symlink (120000)"
+	case submoduleMode:
+		return "submodule (160000)"
+	default:
+		return mode
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// classifyPeekSize is how much of a blob is inspected to classify it.
+const classifyPeekSize = 64 * 1024
+
+// binaryPeekSize is how much of a file git looks at to tell whether it is
+// binary.
+const binaryPeekSize = 8000
+
+// defaultMaxFileSize is the size above which a text file is summarized
+// instead of diffed, unless overridden by `diff.max_file_size`.
+const defaultMaxFileSize = 1024 * 1024
+
+var lfsPointerHeader = []byte("version https://git-lfs.github.com/spec/v1")
+
+var vendoredDirs = []string{
+	"vendor/",
+	"node_modules/",
+	"third_party/",
+	"bower_components/",
+	".yarn/",
+}
+
+var generatedSuffixes = []string{
+	".pb.go",
+	".pb.gw.go",
+	"_gen.go",
+	".gen.go",
+	"_generated.go",
+	".generated.ts",
+	".generated.cs",
+	".designer.cs",
+	"_pb2.py",
+	".snap",
+	".map",
+}
+
+// generatedMarkers match the whole comment lines generated files are marked
+// with, so that mentioning them in a regular file does not count.
+var generatedMarkers = []*regexp.Regexp{
+	// https://go.dev/s/generatedcode
+	regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.\r?$`),
+	regexp.MustCompile(`(?m)^\s*(//|#|/?\*|--|<!--)\s*@generated\b`),
+	regexp.MustCompile(`(?mi)^\s*(//|#|/?\*|--|<!--)\s*(this (file|code) (is|was) )?auto-?generated\b`),
+}
+
+// classifyFile tells whether a staged file should be summarized rather than
+// diffed, from its path, the first classifyPeekSize bytes of its content and
+// its full size.
+func classifyFile(file string, head []byte, size int64) FileKind {
+	switch {
+	case bytes.HasPrefix(head, lfsPointerHeader):
+		return KindLFSPointer
+	case isBinary(head):
+		return KindBinary
+	case isVendored(file):
+		return KindVendored
+	case isGenerated(file, head):
+		return KindGenerated
+	case isMinified(file, head):
+		return KindMinified
+	case size > maxFileSize():
+		return KindLarge
+	default:
+		return KindText
+	}
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000
+// bytes.
+func isBinary(content []byte) bool {
+	if len(content) > binaryPeekSize {
+		content = content[:binaryPeekSize]
+	}
+
+	return bytes.IndexByte(content, 0) != -1
+}
+
+func isVendored(file string) bool {
+	for _, dir := range vendoredDirs {
+		if strings.HasPrefix(file, dir) || strings.Contains(file, "/"+dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isGenerated(file string, head []byte) bool {
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+
+	// Generated file markers conventionally appear in the first few lines.
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	for _, marker := range generatedMarkers {
+		if marker.Match(head) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isMinified(file string, head []byte) bool {
+	if strings.Contains(path.Base(file), ".min.") {
+		return true
+	}
+
+	// Short files are never worth summarizing, whatever their shape.
+	if len(head) < 4096 {
+		return false
+	}
+
+	lines := bytes.Count(head, []byte("\n")) + 1
+	return len(head)/lines > 500
+}
+
+func maxFileSize() int64 {
+	if size := viper.GetInt64("diff.max_file_size"); size > 0 {
+		return size
+	}
+
+	return defaultMaxFileSize
+}
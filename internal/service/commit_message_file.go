@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultCommentChar is git's default core.commentChar, which starts the
+// lines of a message file that are not part of the message.
+const defaultCommentChar = "#"
+
+// maxStatBarWidth bounds the +/- bar of the diff stat.
+const maxStatBarWidth = 40
+
+// CommitMessageFile renders message the way `git commit -v` lays out
+// COMMIT_EDITMSG: the message followed by the branch, the status of the
+// staged files and their diff stat, all commented out with commentChar.
+func CommitMessageFile(message string, changes *StagedChanges, branch, commentChar string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(message, "\n") + "\n\n")
+
+	comment := func(line string) {
+		if line == "" {
+			b.WriteString(commentChar + "\n")
+			return
+		}
+		b.WriteString(commentChar + " " + line + "\n")
+	}
+
+	comment("Please enter the commit message for your changes. Lines starting")
+	comment("with '" + commentChar + "' will be ignored, and an empty message keeps the previous one.")
+	comment("")
+	if branch != "" {
+		comment("On branch " + branch)
+	}
+	comment("Changes to be committed:")
+	for _, file := range changes.Files {
+		b.WriteString(commentChar + "\t" + describeStatus(file) + "\n")
+	}
+	comment("")
+
+	stat := diffStat(changes)
+	if len(stat) > 0 {
+		comment("Diff stat:")
+		for _, line := range stat {
+			comment(line)
+		}
+		comment("")
+	}
+
+	return b.String()
+}
+
+// describeStatus renders a staged file like the "Changes to be committed"
+// section of `git status`.
+func describeStatus(file FileChange) string {
+	switch file.Status {
+	case StatusAdded:
+		return "new file:   " + file.Path
+	case StatusDeleted:
+		return "deleted:    " + file.Path
+	case StatusRenamed:
+		return fmt.Sprintf("renamed:    %s -> %s", file.OldPath, file.Path)
+	case StatusCopied:
+		return fmt.Sprintf("copied:     %s -> %s", file.OldPath, file.Path)
+	case StatusTypeChanged:
+		return "typechange: " + file.Path
+	default:
+		return "modified:   " + file.Path
+	}
+}
+
+// diffStat renders the lines of a `git diff --stat` for the staged files.
+// Files left out of the diff get their kind and size change instead of a
+// line count.
+func diffStat(changes *StagedChanges) []string {
+	type fileStat struct {
+		path           string
+		added, removed int
+		description    string
+		hasCount       bool
+	}
+
+	diffs := changes.FileDiffs()
+	var stats []fileStat
+	pathWidth, maxCount := 0, 0
+	for _, file := range changes.Files {
+		stat := fileStat{path: file.Path}
+		switch {
+		case file.Status == StatusDeleted:
+			stat.description = "deleted"
+		case file.Summarized() && file.SizeKnown:
+			stat.description = fmt.Sprintf("%s, %s", file.Kind, file.SizeSummary())
+		case file.Summarized():
+			stat.description = string(file.Kind)
+		default:
+			stat.added, stat.removed = countChangedLines(diffs[file.Path])
+			stat.hasCount = true
+			maxCount = max(maxCount, stat.added+stat.removed)
+		}
+		stats = append(stats, stat)
+		pathWidth = max(pathWidth, len(stat.path))
+	}
+
+	lines := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		if !stat.hasCount {
+			lines = append(lines, fmt.Sprintf("%-*s | %s", pathWidth, stat.path, stat.description))
+			continue
+		}
+
+		added, removed := stat.added, stat.removed
+		if maxCount > maxStatBarWidth {
+			added = scaleStat(added, maxCount)
+			removed = scaleStat(removed, maxCount)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%-*s | %d %s%s",
+			pathWidth,
+			stat.path,
+			stat.added+stat.removed,
+			strings.Repeat("+", added),
+			strings.Repeat("-", removed),
+		))
+	}
+
+	return lines
+}
+
+// scaleStat scales count to the stat bar, keeping at least one mark for any
+// change.
+func scaleStat(count, maxCount int) int {
+	if count == 0 {
+		return 0
+	}
+
+	return max(count*maxStatBarWidth/maxCount, 1)
+}
+
+// countChangedLines counts the added and removed lines of the diff of a file.
+func countChangedLines(diff string) (int, int) {
+	added, removed := 0, 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+
+	return added, removed
+}
+
+// CleanupMessage turns the content of a message file back into a message
+// like git's default cleanup mode: lines starting with commentChar and
+// trailing whitespace are removed and consecutive blank lines are collapsed.
+func CleanupMessage(content, commentChar string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, commentChar) {
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSuffix(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Convention is a commit message convention: the guidelines given to the
+// model and the rules generated (or edited) messages are linted against.
+type Convention struct {
+	Name string
+	// Rules are the convention specific guidelines of the prompt.
+	Rules string
+	// TypeHint and ScopeHint describe the type and scope fields of the
+	// structured response, SubjectFormat its subject field.
+	TypeHint      string
+	ScopeHint     string
+	SubjectFormat string
+	// SubjectPattern, when set, is what the subject line must match, as
+	// described by SubjectHint.
+	SubjectPattern   *regexp.Regexp
+	SubjectHint      string
+	MaxSubjectLength int
+	// BodyWidth is the column body lines should be wrapped at.
+	BodyWidth int
+	// ProseBody renders body items as paragraphs instead of a bullet list.
+	ProseBody bool
+	// breakingMarker tells whether breaking changes are marked with a "!"
+	// before the colon of the subject.
+	breakingMarker bool
+	// formatSubject assembles the subject line from the structured response.
+	formatSubject func(msg *StructuredMessage) string
+	// lintSubject holds extra checks on the subject line.
+	lintSubject func(subject string) []string
+}
+
+// emptyFieldHint is the TypeHint or ScopeHint of conventions without a type
+// or scope.
+const emptyFieldHint = "always empty"
+
+// DefaultConvention is used when `message.convention` is not set.
+const DefaultConvention = "conventional"
+
+var conventions = map[string]*Convention{
+	"conventional": {
+		Name: "Conventional Commits",
+		Rules: `   - Use conventional commit prefixes (feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert).
+   - Define the scope of the changes:
+     - If changes are related, use a common scope (e.g., component name, feature area)
+     - If changes affect multiple unrelated areas, use "misc" as the scope
+   - Do not include emojis or any decorative elements.`,
+		TypeHint:         "the commit type, one of feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert",
+		ScopeHint:        `the common scope of the changes, "misc" when they affect multiple unrelated areas`,
+		SubjectFormat:    "summary of all changes, without the type and scope (max 50 characters)",
+		SubjectPattern:   regexp.MustCompile(`^(feat|fix|docs|style|refactor|perf|test|build|ci|chore|revert)(\([^()]+\))?!?: \S`),
+		SubjectHint:      "type(scope): subject",
+		MaxSubjectLength: 72,
+		BodyWidth:        72,
+		formatSubject:    typeScopeSubject,
+		breakingMarker:   true,
+	},
+	"gitmoji": {
+		Name: "gitmoji",
+		Rules: `   - Start the subject with the single gitmoji (https://gitmoji.dev) that best describes the intention of the change, written as the unicode emoji, for example:
+     ✨ new feature, 🐛 bug fix, 🚑️ critical hotfix, 📝 documentation, ♻️ refactor, ⚡️ performance, ✅ tests, 🎨 code structure or format, 🔥 remove code or files, 🚚 move or rename files, 🔧 configuration, ⬆️ upgrade dependencies, ⬇️ downgrade dependencies, 💄 UI and style, 🔒️ security, 👷 CI, 🏗️ architecture, 🚀 deploy.
+   - Optionally follow the emoji with a scope in parentheses and a colon.
+   - Do not use conventional commit type prefixes and do not use any other emoji.`,
+		TypeHint:         "the gitmoji, written as the unicode emoji",
+		ScopeHint:        "an optional scope, empty when none fits",
+		SubjectFormat:    "summary of all changes, without the gitmoji and scope (max 55 characters)",
+		SubjectPattern:   regexp.MustCompile(`^(:[a-z0-9_+-]+:|[\x{2190}-\x{2BFF}\x{1F000}-\x{1FAFF}])[\x{FE0F}\x{200D}\x{2190}-\x{2BFF}\x{1F000}-\x{1FAFF}]* \S`),
+		SubjectHint:      "<gitmoji> subject",
+		MaxSubjectLength: 72,
+		BodyWidth:        72,
+		formatSubject: func(msg *StructuredMessage) string {
+			if msg.Scope != "" {
+				return fmt.Sprintf("%s (%s): %s", msg.Type, msg.Scope, msg.Subject)
+			}
+			return fmt.Sprintf("%s %s", msg.Type, msg.Subject)
+		},
+	},
+	"angular": {
+		Name: "Angular",
+		Rules: `   - Use one of the Angular commit types: build, ci, docs, feat, fix, perf, refactor, test.
+   - Always include a scope naming the affected package, module or feature area.
+   - Write the summary in the imperative, present tense ("change" not "changed" nor "changes"), do not capitalize its first letter and do not end it with a period.
+   - Do not include emojis or any decorative elements.`,
+		TypeHint:         "the commit type, one of build, ci, docs, feat, fix, perf, refactor, test",
+		ScopeHint:        "the affected package, module or feature area, never empty",
+		SubjectFormat:    "summary of all changes, without the type and scope (max 80 characters)",
+		SubjectPattern:   regexp.MustCompile(`^(build|ci|docs|feat|fix|perf|refactor|test)\([^()]+\)!?: \S`),
+		SubjectHint:      "type(scope): summary",
+		MaxSubjectLength: 100,
+		BodyWidth:        100,
+		formatSubject:    typeScopeSubject,
+		breakingMarker:   true,
+		lintSubject: func(subject string) []string {
+			var problems []string
+			if _, summary, ok := strings.Cut(subject, ": "); ok {
+				if r, _ := utf8.DecodeRuneInString(summary); unicode.IsUpper(r) {
+					problems = append(problems, "summary should not be capitalized")
+				}
+			}
+			if strings.HasSuffix(subject, ".") {
+				problems = append(problems, "subject should not end with a period")
+			}
+			return problems
+		},
+	},
+	"kernel": {
+		Name: "Linux kernel",
+		Rules: `   - Prefix the subject with the affected subsystem, and optionally the driver or component, each followed by a colon (e.g. "net: ipv4: ", "mm: ", "docs: ").
+   - Write the summary in the imperative mood, as if giving orders to the codebase, and do not end it with a period.
+   - Write the body as plain prose paragraphs explaining the problem and why the change solves it, not as a bullet list of edits.
+   - Do not use conventional commit type prefixes, emojis or any decorative elements.`,
+		TypeHint:         emptyFieldHint,
+		ScopeHint:        `the affected subsystem, optionally followed by the driver or component, e.g. "net: ipv4"`,
+		SubjectFormat:    "summary in the imperative mood, without the subsystem (max 60 characters)",
+		SubjectPattern:   regexp.MustCompile(`^[A-Za-z0-9_./-]+(: [A-Za-z0-9_./-]+)*: \S`),
+		SubjectHint:      "subsystem: summary",
+		MaxSubjectLength: 75,
+		BodyWidth:        75,
+		ProseBody:        true,
+		formatSubject: func(msg *StructuredMessage) string {
+			if msg.Scope == "" {
+				return msg.Subject
+			}
+			return fmt.Sprintf("%s: %s", msg.Scope, msg.Subject)
+		},
+		lintSubject: func(subject string) []string {
+			if strings.HasSuffix(subject, ".") {
+				return []string{"subject should not end with a period"}
+			}
+			return nil
+		},
+	},
+	"free-form": {
+		Name: "free-form",
+		Rules: `   - Do not use any commit type prefix; write a plain, capitalized summary in the imperative mood.
+   - Do not include emojis or any decorative elements.`,
+		TypeHint:         emptyFieldHint,
+		ScopeHint:        emptyFieldHint,
+		SubjectFormat:    "summary of all changes (max 60 characters)",
+		MaxSubjectLength: 72,
+		BodyWidth:        72,
+	},
+}
+
+// typeScopeSubject formats "type(scope)!: subject" subject lines.
+func typeScopeSubject(msg *StructuredMessage) string {
+	var subject strings.Builder
+	subject.WriteString(msg.Type)
+	if msg.Scope != "" {
+		fmt.Fprintf(&subject, "(%s)", msg.Scope)
+	}
+	if msg.BreakingChange != "" {
+		subject.WriteString("!")
+	}
+	fmt.Fprintf(&subject, ": %s", msg.Subject)
+
+	return subject.String()
+}
+
+// HasType tells whether subjects of the convention start with a type.
+func (c *Convention) HasType() bool {
+	return c.TypeHint != emptyFieldHint
+}
+
+// HasScope tells whether subjects of the convention may have a scope.
+func (c *Convention) HasScope() bool {
+	return c.ScopeHint != emptyFieldHint
+}
+
+// EnsureBreakingChange marks message as breaking: a "!" is added to the
+// subject when the convention has one and a BREAKING CHANGE footer holding
+// description is added unless there is one already. The ticket that
+// subjectTemplate adds to the subject, if any, is kept around it.
+func (c *Convention) EnsureBreakingChange(
+	message, description, ticket, subjectTemplate string,
+) (string, error) {
+	subject, rest, _ := strings.Cut(message, "\n")
+	before, formatted, after := splitTicket(subject, ticket, subjectTemplate)
+	if c.breakingMarker && c.SubjectPattern != nil && c.SubjectPattern.MatchString(formatted) {
+		if prefix, summary, ok := strings.Cut(formatted, ": "); ok && !strings.HasSuffix(prefix, "!") {
+			subject = before + prefix + "!: " + summary + after
+		}
+	}
+	if rest != "" {
+		message = subject + "\n" + rest
+	} else {
+		message = subject
+	}
+
+	if HasBreakingChange(message) {
+		return message, nil
+	}
+
+	return ApplyTrailers(message, []Trailer{{breakingChangeKey, description}}, TrailerAdd)
+}
+
+// HasBreakingChange tells whether message has a BREAKING CHANGE footer.
+func HasBreakingChange(message string) bool {
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, breakingChangeKey+": ") || strings.HasPrefix(line, "BREAKING-CHANGE: ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConventionNames lists the supported values of `message.convention`.
+func ConventionNames() []string {
+	return []string{"conventional", "gitmoji", "angular", "kernel", "free-form"}
+}
+
+// ConventionByName returns the convention for a `message.convention` value,
+// the default one when name is empty.
+func ConventionByName(name string) (*Convention, error) {
+	if name == "" {
+		name = DefaultConvention
+	}
+
+	convention, ok := conventions[name]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown commit convention %q. supported conventions are %s",
+			name,
+			strings.Join(ConventionNames(), ", "),
+		)
+	}
+
+	return convention, nil
+}
+
+// Lint returns the problems found in message, an empty slice when it follows
+// the convention. The format of the subject is checked without the ticket
+// that subjectTemplate adds to it, as ApplyTicket does, if any.
+func (c *Convention) Lint(message, ticket, subjectTemplate string) []string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	subject := lines[0]
+
+	var problems []string
+	if strings.TrimSpace(subject) == "" {
+		return []string{"subject line is empty"}
+	}
+
+	formatted := stripTicket(subject, ticket, subjectTemplate)
+	if c.SubjectPattern != nil && !c.SubjectPattern.MatchString(formatted) {
+		problems = append(
+			problems,
+			fmt.Sprintf("subject does not follow the %s format %q", c.Name, c.SubjectHint),
+		)
+	}
+
+	if length := utf8.RuneCountInString(subject); length > c.MaxSubjectLength {
+		problems = append(
+			problems,
+			fmt.Sprintf("subject is %d characters long, the limit is %d", length, c.MaxSubjectLength),
+		)
+	}
+
+	if c.lintSubject != nil {
+		problems = append(problems, c.lintSubject(formatted)...)
+	}
+
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		problems = append(problems, "subject must be followed by a blank line")
+	}
+
+	for i, line := range lines[1:] {
+		// Unbreakable lines such as URLs are fine
+		if utf8.RuneCountInString(line) > c.BodyWidth && strings.Contains(strings.TrimSpace(line), " ") {
+			problems = append(
+				problems,
+				fmt.Sprintf("line %d is longer than %d characters", i+2, c.BodyWidth),
+			)
+		}
+	}
+
+	if strings.Contains(message, "```") {
+		problems = append(problems, "message contains markdown code fences")
+	}
+
+	return problems
+}
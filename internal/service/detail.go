@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DetailLevel is how much the generated message explains, from a lone
+// subject line to an exhaustive body.
+type DetailLevel string
+
+const (
+	// DetailAuto picks a level from the size of the diff.
+	DetailAuto     DetailLevel = "auto"
+	DetailSubject  DetailLevel = "subject"
+	DetailShort    DetailLevel = "short"
+	DetailDetailed DetailLevel = "detailed"
+)
+
+// Thresholds used by SuggestDetailLevel.
+const (
+	subjectOnlyMaxLines = 5
+	shortBodyMaxLines   = 80
+	shortBodyMaxFiles   = 5
+)
+
+// ParseDetailLevel validates a `message.detail` value. An empty value means
+// DetailAuto.
+func ParseDetailLevel(s string) (DetailLevel, error) {
+	switch level := DetailLevel(s); level {
+	case "":
+		return DetailAuto, nil
+	case DetailAuto, DetailSubject, DetailShort, DetailDetailed:
+		return level, nil
+	default:
+		return "", fmt.Errorf(
+			"unknown detail level %q. supported levels are %s, %s, %s and %s",
+			s,
+			DetailAuto,
+			DetailSubject,
+			DetailShort,
+			DetailDetailed,
+		)
+	}
+}
+
+// SuggestDetailLevel picks a detail level from the size of the changes: a
+// subject line is enough for a one-line fix, while large changes get a
+// detailed body.
+func SuggestDetailLevel(changes *StagedChanges) DetailLevel {
+	lines := changes.ChangedLines()
+
+	switch {
+	case len(changes.Files) == 1 && lines <= subjectOnlyMaxLines:
+		return DetailSubject
+	case len(changes.Files) <= shortBodyMaxFiles && lines <= shortBodyMaxLines:
+		return DetailShort
+	default:
+		return DetailDetailed
+	}
+}
+
+// detailPreset holds the parts of the prompt that depend on the detail level.
+type detailPreset struct {
+	// body describes the body field of the response.
+	body string
+	// bodyRules is the "In the body" guideline.
+	bodyRules string
+	// coverage is the guideline on how much of the diff must be described.
+	coverage string
+	// closing is the last sentence of the prompt.
+	closing string
+}
+
+var detailPresets = map[DetailLevel]detailPreset{
+	DetailSubject: {
+		body:      "always empty, the message is the subject line only",
+		bodyRules: "Do not write a body or footers; the subject line alone must summarize the change.",
+		coverage:  "Ensure the subject line reflects the change as a whole.",
+		closing:   "Leave the body empty.",
+	},
+	DetailShort: {
+		body: "at most 3 short items explaining what changed and why",
+		bodyRules: strings.Join([]string{
+			"In the body:",
+			"    - Focus on why the change was made rather than listing every edit",
+			"    - Mention only the most significant changes",
+			"    - Do not describe each file separately",
+		}, "\n"),
+		coverage: "Ensure the message reflects the change as a whole, without going into every detail.",
+		closing:  "Keep the body brief.",
+	},
+	DetailDetailed: {
+		body: "one item per change, together giving an exhaustive explanation of all changes",
+		bodyRules: strings.Join([]string{
+			"In the body:",
+			"    - List each change separately",
+			"    - Explain the purpose and impact of each change in detail",
+			"    - Include specific file names and paths when relevant",
+			"    - Describe any new functionality or behavior changes",
+			"    - Mention any potential side effects or areas that might be affected",
+			"    - If the changes affect multiple unrelated areas, clearly delineate and explain each unrelated change",
+		}, "\n"),
+		coverage: "Ensure all changes from the diff are represented in the commit message, with detailed explanations for each.",
+		closing:  "Be thorough and detailed in the body of the commit message.",
+	},
+}
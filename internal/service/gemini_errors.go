@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/spf13/viper"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrorKind classifies why a generation failed.
+type ErrorKind string
+
+const (
+	ErrorAuth          ErrorKind = "authentication failed"
+	ErrorModelNotFound ErrorKind = "model not found"
+	ErrorQuota         ErrorKind = "quota exceeded"
+	ErrorSafety        ErrorKind = "response blocked"
+	ErrorEmptyResponse ErrorKind = "empty response"
+	ErrorNetwork       ErrorKind = "network error"
+	ErrorTimeout       ErrorKind = "request timed out"
+	ErrorUnavailable   ErrorKind = "service unavailable"
+	ErrorUnknown       ErrorKind = "request failed"
+)
+
+var errorHints = map[ErrorKind]string{
+	ErrorAuth:          "check your API key with `geminicommit config key show`, or set a new one with `geminicommit config key set`",
+	ErrorModelNotFound: "the model may have been retired, pick another one with `geminicommit config model set` or add fallbacks to model.fallbacks",
+	ErrorQuota:         "the API rate limit or quota was reached, wait a moment and try again or check the limits of your plan",
+	ErrorSafety:        "the model refused to answer for safety reasons, try again with a clue or another model",
+	ErrorEmptyResponse: "the diff may be too large or contain unsupported content",
+	ErrorNetwork:       "check your internet connection and proxy settings",
+	ErrorTimeout:       "raise api.timeout or stage fewer changes",
+	ErrorUnavailable:   "the Gemini API is overloaded or down, try again later",
+	ErrorUnknown:       "try again later",
+}
+
+// Defaults of the `api.timeout` and `api.max_retries` config keys.
+const (
+	defaultRequestTimeout = 60 * time.Second
+	defaultMaxRetries     = 3
+)
+
+// Bounds of the exponential backoff between retries.
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// GenerationError is a failed generation along with its classification.
+type GenerationError struct {
+	Kind ErrorKind
+	Err  error
+	// Model is the model that failed, when known.
+	Model string
+}
+
+func (e *GenerationError) Error() string {
+	if e.Model != "" {
+		return fmt.Sprintf("%s: %s. %s\n%v", e.Model, e.Kind, errorHints[e.Kind], e.Err)
+	}
+
+	return fmt.Sprintf("%s. %s\n%v", e.Kind, errorHints[e.Kind], e.Err)
+}
+
+func (e *GenerationError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether trying again later may succeed.
+func (e *GenerationError) Retryable() bool {
+	switch e.Kind {
+	case ErrorQuota, ErrorNetwork, ErrorTimeout, ErrorUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// canFallBack reports whether another model may succeed where this one
+// failed.
+func (e *GenerationError) canFallBack() bool {
+	switch e.Kind {
+	case ErrorModelNotFound, ErrorQuota, ErrorSafety, ErrorEmptyResponse, ErrorUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// classifyError wraps an error of the Gemini client in a GenerationError.
+func classifyError(err error) *GenerationError {
+	var genErr *GenerationError
+	if errors.As(err, &genErr) {
+		return genErr
+	}
+
+	var blocked *genai.BlockedError
+	var apiErr *googleapi.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &blocked):
+		return &GenerationError{Kind: ErrorSafety, Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &GenerationError{Kind: ErrorTimeout, Err: err}
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden:
+			return &GenerationError{Kind: ErrorAuth, Err: err}
+		case apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, "API key"):
+			// An invalid API key is reported as a bad request
+			return &GenerationError{Kind: ErrorAuth, Err: err}
+		case apiErr.Code == http.StatusNotFound:
+			return &GenerationError{Kind: ErrorModelNotFound, Err: err}
+		case apiErr.Code == http.StatusTooManyRequests:
+			return &GenerationError{Kind: ErrorQuota, Err: err}
+		case apiErr.Code == http.StatusGatewayTimeout:
+			return &GenerationError{Kind: ErrorTimeout, Err: err}
+		case apiErr.Code >= http.StatusInternalServerError:
+			return &GenerationError{Kind: ErrorUnavailable, Err: err}
+		}
+	case errors.As(err, &netErr):
+		return &GenerationError{Kind: ErrorNetwork, Err: err}
+	}
+
+	return &GenerationError{Kind: ErrorUnknown, Err: err}
+}
+
+// generate sends prompt to model, each attempt bounded by `api.timeout`, and
+// retries retryable failures up to `api.max_retries` times with exponential
+// backoff and full jitter.
+func generate(
+	ctx context.Context,
+	model *genai.GenerativeModel,
+	prompt string,
+	onRetry func(err *GenerationError, retry, maxRetries int, delay time.Duration),
+) (*genai.GenerateContentResponse, error) {
+	retries := maxRetries()
+
+	for attempt := 0; ; attempt++ {
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout())
+		resp, err := model.GenerateContent(reqCtx, genai.Text(prompt))
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+
+		genErr := classifyError(err)
+		if !genErr.Retryable() || attempt >= retries || ctx.Err() != nil {
+			return nil, genErr
+		}
+
+		delay := backoffDelay(attempt)
+		if onRetry != nil {
+			onRetry(genErr, attempt+1, retries, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, classifyError(ctx.Err())
+		}
+	}
+}
+
+// backoffDelay returns a random delay up to retryBaseDelay * 2^attempt,
+// capped at retryMaxDelay.
+func backoffDelay(attempt int) time.Duration {
+	ceiling := retryMaxDelay
+	if attempt < 16 {
+		ceiling = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+
+	return rand.N(ceiling) + 1
+}
+
+func requestTimeout() time.Duration {
+	if timeout := viper.GetDuration("api.timeout"); timeout > 0 {
+		return timeout
+	}
+
+	return defaultRequestTimeout
+}
+
+func maxRetries() int {
+	if viper.IsSet("api.max_retries") {
+		return max(viper.GetInt("api.max_retries"), 0)
+	}
+
+	return defaultMaxRetries
+}
@@ -2,40 +2,166 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/spf13/viper"
 	"google.golang.org/api/option"
 )
 
-type GeminiService struct{}
+// PromptVersion identifies the prompt template. Bump it whenever the prompt
+// changes in a way that affects the generated messages.
+const PromptVersion = 5
 
-func NewGeminiService() *GeminiService {
-	return &GeminiService{}
+// defaultModel is used when `model.default` is not set.
+const defaultModel = "gemini-2.0-flash-exp"
+
+type GeminiService struct {
+	cache *ResponseCache
+}
+
+// AnalyzeOptions carries the optional context used to steer generation.
+type AnalyzeOptions struct {
+	// PromptAddition is an extra focus given by the user (the clue).
+	PromptAddition *string
+	// StyleExamples are recent commit messages of the repository whose
+	// style the generated message should match.
+	StyleExamples []string
+	// Template is the content of the `commit.template` file of the
+	// repository, whose structure the generated message should follow. The
+	// body is then laid out as the model wrote it rather than as a list.
+	Template string
+	// CommentChar starts the comment lines of Template, "#" when empty.
+	CommentChar string
+	// Detail is how much the message explains, DetailDetailed when empty.
+	Detail DetailLevel
+	// BreakingChanges are the probable breaking changes of the diff, given to
+	// the model as hints. The message is only marked as breaking when the
+	// model confirms them or the user accepts them.
+	BreakingChanges []BreakingChange
+	// SkipCache forces a new generation even if the response cache holds a
+	// message for the same prompt. The new message is still cached.
+	SkipCache bool
+	// OnRetry, when set, is called before waiting delay to retry a failed
+	// request.
+	OnRetry func(err *GenerationError, retry, maxRetries int, delay time.Duration)
+	// OnFallback, when set, is called when err makes AnalyzeChanges move on to
+	// the next model.
+	OnFallback func(err *GenerationError, next string)
+}
+
+func NewGeminiService(cache *ResponseCache) *GeminiService {
+	return &GeminiService{cache}
+}
+
+// ModelName returns the name of the primary model messages are generated
+// with.
+func (g *GeminiService) ModelName() string {
+	if model := viper.GetString("model.default"); model != "" {
+		return model
+	}
+
+	return defaultModel
 }
 
+// Models returns the primary model followed by the `model.fallbacks` ones, in
+// the order they are tried.
+func (g *GeminiService) Models() []string {
+	models := []string{g.ModelName()}
+	for _, model := range viper.GetStringSlice("model.fallbacks") {
+		if model = strings.TrimSpace(model); model != "" && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+
+	return models
+}
+
+// AnalyzeResult is the outcome of AnalyzeChanges.
+type AnalyzeResult struct {
+	Message string
+	// Structured holds the fields Message was assembled from, nil when the
+	// model ignored the response schema and Message is its raw answer.
+	Structured *StructuredMessage
+	// Model is the model that produced the message.
+	Model string
+	// Usage is the token usage of the generation, nil when the model did not
+	// report it or the message was cached.
+	Usage *TokenUsage
+	// Cached tells whether the message was read from the response cache
+	// rather than generated.
+	Cached bool
+}
+
+// AnalyzeChanges generates a commit message for changes with the first model
+// of Models that succeeds. A model is skipped for the next one when it is
+// missing, out of quota, unavailable or its answer was blocked or empty.
 func (g *GeminiService) AnalyzeChanges(
 	ctx context.Context,
-	diff string,
-	deletedFiles []string,
-	promptAddition *string,
-) (string, error) {
+	changes *StagedChanges,
+	opts AnalyzeOptions,
+) (*AnalyzeResult, error) {
+	convention, err := ConventionByName(viper.GetString("message.convention"))
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := buildPrompt(changes, convention, opts)
+
 	client, err := genai.NewClient(
 		ctx,
 		option.WithAPIKey(viper.GetString("api.key")),
 	)
 	if err != nil {
-		fmt.Println("Error:", err)
-		return "", err
+		return nil, fmt.Errorf("failed to create Gemini client. %v", err)
 	}
 	defer client.Close()
-	defaultModel := viper.GetString("model.default")
-	if defaultModel == "" {
-		defaultModel = "gemini-2.0-flash-exp"
+
+	models := g.Models()
+	for i, modelName := range models {
+		result, err := g.analyzeWithModel(ctx, client, modelName, convention, prompt, opts)
+		if err == nil {
+			return result, nil
+		}
+
+		genErr := classifyError(err)
+		genErr.Model = modelName
+		if !genErr.canFallBack() || i == len(models)-1 {
+			return nil, genErr
+		}
+
+		if opts.OnFallback != nil {
+			opts.OnFallback(genErr, models[i+1])
+		}
+	}
+
+	return nil, errors.New("no model configured")
+}
+
+func (g *GeminiService) analyzeWithModel(
+	ctx context.Context,
+	client *genai.Client,
+	modelName string,
+	convention *Convention,
+	prompt string,
+	opts AnalyzeOptions,
+) (*AnalyzeResult, error) {
+	cacheKey := ResponseCacheKey(modelName, prompt)
+	if viper.GetBool("cache.enabled") && !opts.SkipCache {
+		if response, ok := g.cache.Get(cacheKey); ok {
+			result := newAnalyzeResult(convention, response, opts.followsTemplate())
+			result.Model, result.Cached = modelName, true
+			return result, nil
+		}
 	}
-	model := client.GenerativeModel(defaultModel)
+
+	model := client.GenerativeModel(modelName)
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = responseSchema(convention)
 	safetySettings := []*genai.SafetySetting{
 		{
 			Category:  genai.HarmCategoryHarassment,
@@ -55,85 +181,190 @@ func (g *GeminiService) AnalyzeChanges(
 		},
 	}
 	model.SafetySettings = safetySettings
+	resp, err := generate(ctx, model, prompt, opts.OnRetry)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, &GenerationError{
+			Kind: ErrorSafety,
+			Err:  errors.New("AI service returned no response candidates"),
+		}
+	}
+
+	if resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, &GenerationError{
+			Kind: ErrorEmptyResponse,
+			Err:  errors.New("AI service returned empty response content"),
+		}
+	}
+
+	response := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
+	if viper.GetBool("cache.enabled") {
+		// A cache that cannot be written only costs a later generation
+		_ = g.cache.Put(cacheKey, response)
+	}
+
+	result := newAnalyzeResult(convention, response, opts.followsTemplate())
+	result.Model = modelName
+	if resp.UsageMetadata != nil {
+		result.Usage = &TokenUsage{
+			PromptTokens:   int(resp.UsageMetadata.PromptTokenCount),
+			ResponseTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		}
+	}
+
+	return result, nil
+}
+
+// followsTemplate tells whether the message is laid out after a commit
+// template.
+func (opts AnalyzeOptions) followsTemplate() bool {
+	return strings.TrimSpace(opts.Template) != ""
+}
+
+// newAnalyzeResult assembles the message of a response. Models that do not
+// support response schemas answer in free text, which is used as is.
+// freeFormBody keeps the body as the model laid it out.
+func newAnalyzeResult(convention *Convention, response string, freeFormBody bool) *AnalyzeResult {
+	result := &AnalyzeResult{Message: stripCodeFence(response)}
+	if structured, err := ParseStructuredMessage(response); err == nil {
+		structured.FreeFormBody = freeFormBody
+		result.Message, result.Structured = convention.Assemble(structured), structured
+	}
+
+	return result
+}
+
+// buildPrompt renders the prompt sent to the model.
+func buildPrompt(changes *StagedChanges, convention *Convention, opts AnalyzeOptions) string {
 	var injection string
-	if promptAddition == nil {
+	if opts.PromptAddition == nil {
 		injection = ""
 	} else {
-		injection = fmt.Sprintf("with additional focus on %s", *promptAddition)
+		injection = fmt.Sprintf("with additional focus on %s", *opts.PromptAddition)
 	}
 
 	var deletedFilesInfo string
-	if len(deletedFiles) > 0 {
+	if deletedFiles := changes.DeletedFiles(); len(deletedFiles) > 0 {
 		deletedFilesInfo = fmt.Sprintf("\n\nDeleted files:\n%s", strings.Join(deletedFiles, "\n"))
 	} else {
 		deletedFilesInfo = ""
 	}
 
-	resp, err := model.GenerateContent(
-		ctx,
-		genai.Text(
-			fmt.Sprintf(
-				`
-You are an AI assistant specialized in generating conventional git commit messages based on provided diff changes. Follow these guidelines:
-
-1. Analyze the following diff changes %s
-%s%s
-
-2. Generate a well-formed git commit message based on all the staged file contents (except the package configuration files (go.mod/package.json/cargo.toml/etc...)).
-3. Be concise and direct
-4. Focus on why the changes were made, providing context and reasoning.
-5. Use conventional commit prefixes (feat, fix, docs, style, refactor, perf, test, chore).
-6. Define the scope of the changes:
-   - If changes are related, use a common scope (e.g., component name, feature area)
-   - If changes affect multiple unrelated areas, use "misc" as the scope
-7. Do not include emojis or any decorative elements.
-8. Consider all changes to:
+	var breakingChangesInfo string
+	if len(opts.BreakingChanges) > 0 {
+		var found strings.Builder
+		for _, change := range opts.BreakingChanges {
+			fmt.Fprintf(&found, "\n- %s", change)
+		}
+		breakingChangesInfo = fmt.Sprintf(
+			"\n\nProbable breaking changes flagged by a heuristic over the diff. They may be false positives, so only describe in breaking_change those the diff confirms:%s",
+			found.String(),
+		)
+	} else {
+		breakingChangesInfo = ""
+	}
+
+	var styleExamplesInfo string
+	if len(opts.StyleExamples) > 0 {
+		styleExamplesInfo = fmt.Sprintf(
+			"\n\nRecent commit messages of this repository, each separated by a line containing only \"---\". Match their tone, capitalization, scope names and level of detail, but do not copy their content:\n%s\n",
+			strings.Join(opts.StyleExamples, "\n---\n"),
+		)
+	} else {
+		styleExamplesInfo = ""
+	}
+
+	var templateInfo string
+	bodyLayout := "Write each body item as plain sentences, without leading dashes, numbering or line breaks; the message is laid out and wrapped for you."
+	if opts.followsTemplate() {
+		commentChar := opts.CommentChar
+		if commentChar == "" {
+			commentChar = defaultCommentChar
+		}
+		templateInfo = fmt.Sprintf(
+			"\n\nThe commit template of this repository. Lay out the subject and the body the way it does and fill every part of it from the diff, but do not copy its placeholder text or its comment lines starting with %q:\n%s\n",
+			commentChar,
+			strings.TrimSpace(opts.Template),
+		)
+		bodyLayout = "Write one body item per part of the commit template, in its order. An item may span several lines and keep the headings, lists and line breaks of the template; it is kept as written and separated from the next one by a blank line."
+	} else {
+		templateInfo = ""
+	}
+
+	detail, ok := detailPresets[opts.Detail]
+	if !ok {
+		detail = detailPresets[DetailDetailed]
+	}
+
+	rules := []string{
+		fmt.Sprintf(
+			"Analyze the following diff changes %s\n%s%s%s%s\n",
+			injection,
+			changes.Diff,
+			deletedFilesInfo,
+			changes.Summary(),
+			breakingChangesInfo,
+		),
+		"Generate a well-formed git commit message based on all the staged file contents (except the package configuration files (go.mod/package.json/cargo.toml/etc...)).",
+		"Be concise and direct",
+		"Focus on why the changes were made, providing context and reasoning.",
+		fmt.Sprintf("Follow the %s commit message convention:\n%s", convention.Name, convention.Rules),
+		`Consider all changes to:
    - Source files for programming languages
    - Shell configuration files
    - Documentation (README, .md files)
    - Package management files
    - Deleted files (if any are listed separately)
-9. Exclude changes to lock files, sum files, or any generated artifacts.
-10. Format:
-   - First line: Commit type(scope): Subject summarizing all changes (max 60 characters)
-   - Blank line
-   - Body: Provide an exhaustive explanation of all changes (wrap at 72 characters)
-11. In the body:
-    - List each change separately
-    - Explain the purpose and impact of each change in detail
-    - Include specific file names and paths when relevant
-    - Describe any new functionality or behavior changes
-    - Mention any potential side effects or areas that might be affected
-    - If using "misc" scope, clearly delineate and explain each unrelated change
-12. Exclude any unnecessary information or formatting.
-13. Do not include any introductory text before the commit message.
-14. Do not include any notes, explanations, or comments after the commit message.
-15. Provide only the commit message itself, exactly as it should appear in the git commit.
-16. Ensure all changes from the diff are represented in the commit message, with detailed explanations for each.
-
-Your entire response will be used directly in a git commit command, so include only the commit message text. NEVER USE markdown formatting. Be thorough and detailed in the body of the commit message.
-				`,
-				injection,
-				diff,
-				deletedFilesInfo,
-			),
+   - Renamed, moved or copied files and permission changes (if any are listed separately); describe moves as moves, not as deletions and additions
+   - Files left out of the diff (binary, generated, minified, vendored, Git LFS pointers, large files); describe them from their kind and size change only
+   - Submodule updates (if any are listed separately); summarize what was bumped from the listed submodule commits`,
+		"Exclude changes to lock files, sum files, or any generated artifacts.",
+		fmt.Sprintf(
+			`Fill the fields of the JSON response:
+   - type: %s
+   - scope: %s
+   - subject: %s
+   - body: %s
+   - breaking_change: what breaks backward compatibility (removed or changed public APIs, flags, configuration or file formats) and how to migrate, empty when nothing does
+   - footers: trailers such as "Refs", only when the user asked for them, otherwise empty`,
+			convention.TypeHint,
+			convention.ScopeHint,
+			convention.SubjectFormat,
+			detail.body,
 		),
-	)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return "", err
+		detail.bodyRules,
+		"Exclude any unnecessary information or formatting.",
+		"Do not repeat the type, scope or subject in the body.",
+		"Do not include any notes, explanations, or comments about the commit message itself.",
+		bodyLayout,
+		detail.coverage,
 	}
-	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf(
-			"failed to generate commit message: AI service returned no response candidates (possibly due to content filtering or safety restrictions)",
-		)
+	if language := strings.TrimSpace(viper.GetString("message.language")); language != "" {
+		rules = append(rules, fmt.Sprintf(
+			"Write the subject and the body in %s. Keep the commit type keywords (feat, fix, docs, etc.) and any other prefix required by the convention, scopes, code identifiers, file names and paths, and trailer keys in English exactly as they are.",
+			language,
+		))
 	}
 
-	if len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf(
-			"failed to generate commit message: AI service returned empty response content (the diff may be too large or contain unsupported content)",
-		)
+	// Rules are numbered here so that optional ones keep the list in sequence
+	var guidelines strings.Builder
+	for i, rule := range rules {
+		fmt.Fprintf(&guidelines, "%d. %s\n", i+1, rule)
 	}
 
-	return fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]), nil
+	return fmt.Sprintf(
+		`
+You are an AI assistant specialized in generating git commit messages based on provided diff changes. Follow these guidelines:
+
+%s%s%s
+
+Your response is assembled into the commit message, so NEVER USE markdown formatting in any field. %s
+		`,
+		guidelines.String(),
+		styleExamplesInfo,
+		templateInfo,
+		detail.closing,
+	)
 }
@@ -1,16 +1,70 @@
 package service
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-type GitService struct{}
+// GitService is the set of git operations geminicommit relies on. It is
+// implemented by ExecGitService, which shells out to the git binary, and by
+// GoGitService, which works in-process on top of go-git.
+type GitService interface {
+	VerifyGitInstallation() error
+	VerifyGitRepository() error
+	RepositoryRoot() (string, error)
+	HasPreCommitHook() (bool, error)
+	PreCommitHookPath() (string, error)
+	IsExecutable(path string) bool
+	RunPreCommitHook(path string) error
+	StageAll() error
+	StagedFiles() ([]string, error)
+	HashWorkingTreeFiles(files []string) (map[string]string, error)
+	IndexHashes(files []string) (map[string]string, error)
+	StageFiles(files []string) error
+	UnstagedChanges() ([]UnstagedFile, error)
+	StageHunks(path string, hunks []Hunk) error
+	DetectDiffChanges() (*StagedChanges, error)
+	RecentCommitMessages(limit int, author string, paths []string) ([]string, error)
+	CurrentBranch() (string, error)
+	RecentAuthors(commits int) ([]string, error)
+	UserIdentity() (string, error)
+	CommitChanges(message string) error
+	HeadCommit() (string, error)
+	ReadBlobs(hashes []string) (map[string][]byte, error)
+	Editor() (string, error)
+	GitDir() (string, error)
+	CommentChar() (string, error)
+	CommitTemplate() (string, error)
+}
+
+// NewGitService returns the GitService implementation for the given backend
+// name, as configured by the `git.backend` config key.
+func NewGitService(backend string) (GitService, error) {
+	switch backend {
+	case "", "exec":
+		return NewExecGitService(), nil
+	case "go-git":
+		return NewGoGitService(), nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown git backend %q. supported backends are \"exec\" and \"go-git\"",
+			backend,
+		)
+	}
+}
+
+// ExecGitService implements GitService by shelling out to the git binary.
+type ExecGitService struct{}
 
 // HasPreCommitHook checks if .git/hooks/pre-commit exists in the current repository.
-func (g *GitService) HasPreCommitHook() (bool, error) {
+func (g *ExecGitService) HasPreCommitHook() (bool, error) {
 	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
 	output, err := cmd.Output()
 	if err != nil {
@@ -25,7 +79,7 @@ func (g *GitService) HasPreCommitHook() (bool, error) {
 }
 
 // PreCommitHookPath returns the path to the pre-commit hook if it exists, or an empty string otherwise.
-func (g *GitService) PreCommitHookPath() (string, error) {
+func (g *ExecGitService) PreCommitHookPath() (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
 	output, err := cmd.Output()
 	if err != nil {
@@ -40,23 +94,226 @@ func (g *GitService) PreCommitHookPath() (string, error) {
 }
 
 // IsExecutable checks if the given file is executable
-func (g *GitService) IsExecutable(path string) bool {
+func (g *ExecGitService) IsExecutable(path string) bool {
 	return exec.Command("test", "-x", path).Run() == nil
 }
 
 // RunPreCommitHook executes the pre-commit hook and streams all output to the terminal
-func (g *GitService) RunPreCommitHook(path string) error {
+func (g *ExecGitService) RunPreCommitHook(path string) error {
 	cmd := exec.Command(path)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func NewGitService() *GitService {
-	return &GitService{}
+// RepositoryRoot returns the absolute path of the top-level directory of the
+// current repository.
+func (g *ExecGitService) RepositoryRoot() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
 }
 
-func (g *GitService) VerifyGitInstallation() error {
+// StagedFiles returns the paths of staged files that still exist in the
+// index, i.e. everything but deletions. Paths are relative to the repository
+// root.
+func (g *ExecGitService) StagedFiles() ([]string, error) {
+	output, err := exec.Command("git", "diff", "--cached", "--name-only", "--diff-filter=ACMR").
+		Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged files. %v", err)
+	}
+
+	filesStr := strings.TrimSpace(string(output))
+	if filesStr == "" {
+		return nil, nil
+	}
+
+	return strings.Split(filesStr, "\n"), nil
+}
+
+// IndexHashes returns the blob hash of each given file in the index. Files
+// missing from the index are left out.
+func (g *ExecGitService) IndexHashes(files []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(files))
+	if len(files) == 0 {
+		return hashes, nil
+	}
+
+	repoRoot, err := g.RepositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", append([]string{"ls-files", "--stage", "-z", "--"}, files...)...)
+	cmd.Dir = repoRoot
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the index. %v", err)
+	}
+
+	// Each entry is "<mode> <hash> <stage>\t<path>"
+	for _, entry := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		hashes[path] = fields[1]
+	}
+
+	return hashes, nil
+}
+
+// HashWorkingTreeFiles returns the blob hash of the working tree content of
+// each given file. Files missing from the working tree are left out.
+func (g *ExecGitService) HashWorkingTreeFiles(files []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(files))
+
+	repoRoot, err := g.RepositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(repoRoot, file)); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	if len(existing) == 0 {
+		return hashes, nil
+	}
+
+	cmd := exec.Command("git", append([]string{"hash-object", "--"}, existing...)...)
+	cmd.Dir = repoRoot
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash working tree files. %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(existing) {
+		return nil, fmt.Errorf("failed to hash working tree files. unexpected output")
+	}
+	for i, file := range existing {
+		hashes[file] = lines[i]
+	}
+
+	return hashes, nil
+}
+
+// StageFiles adds the given files to the index.
+func (g *ExecGitService) StageFiles(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	repoRoot, err := g.RepositoryRoot()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("git", append([]string{"add", "--"}, files...)...)
+	cmd.Dir = repoRoot
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to stage files. %v", err)
+	}
+
+	return nil
+}
+
+// UnstagedChanges lists the changes of the working tree that are not staged,
+// untracked files included, across the whole repository.
+func (g *ExecGitService) UnstagedChanges() ([]UnstagedFile, error) {
+	repoRoot, err := g.RepositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(
+		"git", "-c", "core.quotePath=false",
+		"diff", "--no-color", "--no-ext-diff", "--no-renames", "--src-prefix=a/", "--dst-prefix=b/",
+	)
+	cmd.Dir = repoRoot
+	diff, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unstaged changes. %v", err)
+	}
+
+	files, err := parseUnstagedDiff(string(diff))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unstaged changes. %v", err)
+	}
+
+	cmd = exec.Command("git", "ls-files", "--others", "--exclude-standard", "-z")
+	cmd.Dir = repoRoot
+	untracked, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files. %v", err)
+	}
+	for _, file := range strings.Split(strings.TrimSuffix(string(untracked), "\x00"), "\x00") {
+		if file == "" {
+			continue
+		}
+		head, err := readFileHead(filepath.Join(repoRoot, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files. %v", err)
+		}
+		files = append(files, UnstagedFile{Path: file, Status: StatusAdded, Binary: isBinary(head)})
+	}
+
+	return files, nil
+}
+
+// readFileHead reads the first bytes of a file, enough to tell whether it is
+// binary.
+func readFileHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, binaryPeekSize))
+}
+
+// StageHunks stages some of the hunks of a modified file, like
+// `git add --patch` does.
+func (g *ExecGitService) StageHunks(path string, hunks []Hunk) error {
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	repoRoot, err := g.RepositoryRoot()
+	if err != nil {
+		return err
+	}
+
+	var patch strings.Builder
+	fmt.Fprintf(&patch, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	for _, hunk := range hunks {
+		patch.WriteString(hunk.String())
+	}
+
+	cmd := exec.Command("git", "apply", "--cached", "--recount", "-")
+	cmd.Dir = repoRoot
+	cmd.Stdin = strings.NewReader(patch.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v: %s", path, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func NewExecGitService() *ExecGitService {
+	return &ExecGitService{}
+}
+
+func (g *ExecGitService) VerifyGitInstallation() error {
 	if err := exec.Command("git", "--version").Run(); err != nil {
 		return fmt.Errorf("git is not installed. %v", err)
 	}
@@ -64,7 +321,7 @@ func (g *GitService) VerifyGitInstallation() error {
 	return nil
 }
 
-func (g *GitService) VerifyGitRepository() error {
+func (g *ExecGitService) VerifyGitRepository() error {
 	if err := exec.Command("git", "rev-parse", "--show-toplevel").Run(); err != nil {
 		return fmt.Errorf(
 			"the current directory must be a git repository. %v",
@@ -75,7 +332,7 @@ func (g *GitService) VerifyGitRepository() error {
 	return nil
 }
 
-func (g *GitService) StageAll() error {
+func (g *ExecGitService) StageAll() error {
 	if err := exec.Command("git", "add", "-u").Run(); err != nil {
 		return fmt.Errorf("failed to update tracked files. %v", err)
 	}
@@ -83,65 +340,353 @@ func (g *GitService) StageAll() error {
 	return nil
 }
 
-func (g *GitService) DetectDiffChanges() ([]string, []string, string, error) {
-	// Default lock files to exclude if none provided
-	excludePatterns := DefaultLockFilePatterns()
-
-	// Build git command with exclusion patterns for modified/added files
-	fileCmd := []string{"git", "diff", "--cached", "--diff-algorithm=minimal", "--name-only", "--diff-filter=AM", "--", "."}
-	diffCmd := []string{"git", "diff", "--cached", "--diff-algorithm=minimal", "--diff-filter=AM", "--", "."}
-
-	// Build git command for deleted files
-	deletedCmd := []string{"git", "diff", "--cached", "--diff-algorithm=minimal", "--name-only", "--diff-filter=D", "--", "."}
+func (g *ExecGitService) DetectDiffChanges() (*StagedChanges, error) {
+	// Build git command listing every staged file with its status and modes,
+	// detecting renames (-M) and copies (-C)
+	rawCmd := []string{"git", "diff", "--cached", "--raw", "-z", "--no-abbrev", "-M", "-C", "--diff-filter=ACDMRT", "--", "."}
 
-	// Add exclusion patterns to commands
-	for _, pattern := range excludePatterns {
-		fileCmd = append(fileCmd, fmt.Sprintf(":(exclude)%s", pattern))
-		diffCmd = append(diffCmd, fmt.Sprintf(":(exclude)%s", pattern))
-		deletedCmd = append(deletedCmd, fmt.Sprintf(":(exclude)%s", pattern))
+	// Build git command for the diff content of everything but deleted files,
+	// with the default prefixes whatever diff.noprefix or diff.mnemonicPrefix
+	// say, since the diff is split per file by its "b/" paths
+	diffCmd := []string{
+		"git", "diff", "--cached", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/",
+		"--diff-algorithm=minimal", "-M", "-C", "--diff-filter=ACMRT", "--", ".",
 	}
 
-	// Execute file list command for modified/added files
-	files, err := exec.Command(fileCmd[0], fileCmd[1:]...).Output()
+	// Execute file list command
+	raw, err := exec.Command(rawCmd[0], rawCmd[1:]...).Output()
 	if err != nil {
 		fmt.Println("Error:", err)
-		return nil, nil, "", err
+		return nil, err
 	}
 
-	// Execute deleted files command
-	deletedFiles, err := exec.Command(deletedCmd[0], deletedCmd[1:]...).Output()
+	staged, err := parseRawDiff(string(raw))
 	if err != nil {
 		fmt.Println("Error:", err)
-		return nil, nil, "", err
+		return nil, err
 	}
 
-	filesStr := strings.TrimSpace(string(files))
-	deletedFilesStr := strings.TrimSpace(string(deletedFiles))
+	if err := g.classifyFiles(staged); err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	// Lock files are matched here rather than with pathspecs, so that both
+	// backends leave out the same files
+	var files, lockFiles []FileChange
+	for _, file := range staged {
+		if matchesAnyPattern(file.Path, DefaultLockFilePatterns()) {
+			file.Kind = KindLockFile
+			lockFiles = append(lockFiles, file)
+			diffCmd = append(diffCmd, fmt.Sprintf(":(top,exclude,literal)%s", file.Path))
+			continue
+		}
+		files = append(files, file)
+	}
 
 	// Check if we have any changes at all
-	if filesStr == "" && deletedFilesStr == "" {
-		return nil, nil, "", fmt.Errorf("nothing to be analyzed")
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nothing to be analyzed")
+	}
+
+	if err := g.loadSubmoduleLogs(files); err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
 	}
 
-	// Execute diff content command for modified/added files only
+	// Leave the content of summarized files out of the diff
+	for _, file := range files {
+		if file.Summarized() {
+			diffCmd = append(diffCmd, fmt.Sprintf(":(top,exclude,literal)%s", file.Path))
+		}
+	}
+
+	// Execute diff content command
 	diff, err := exec.Command(diffCmd[0], diffCmd[1:]...).Output()
 	if err != nil {
 		fmt.Println("Error:", err)
-		return nil, nil, "", err
+		return nil, err
 	}
 
-	var filesList []string
-	var deletedFilesList []string
+	return &StagedChanges{Files: files, Diff: string(diff), LockFiles: lockFiles}, nil
+}
+
+// parseRawDiff parses the output of `git diff --raw -z`, where each entry is
+// ":<old mode> <new mode> <old sha> <new sha> <status>" followed by one path,
+// or two for renames and copies, all NUL separated.
+func parseRawDiff(raw string) ([]FileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(raw, "\x00"), "\x00")
+
+	var files []FileChange
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff output: %q", fields[i])
+		}
+
+		file := FileChange{
+			Status:  ChangeStatus(meta[4][:1]),
+			OldMode: meta[0],
+			NewMode: meta[1],
+			OldHash: meta[2],
+			NewHash: meta[3],
+		}
+		if file.OldMode == "000000" {
+			file.OldMode = ""
+			file.OldHash = ""
+		}
+		if file.NewMode == "000000" {
+			file.NewMode = ""
+			file.NewHash = ""
+		}
 
-	if filesStr != "" {
-		filesList = strings.Split(filesStr, "\n")
+		switch file.Status {
+		case StatusRenamed, StatusCopied:
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff output: %q", fields[i])
+			}
+			file.Similarity, _ = strconv.Atoi(meta[4][1:])
+			file.OldPath = fields[i+1]
+			file.Path = fields[i+2]
+			i += 2
+		default:
+			file.Path = fields[i+1]
+			i++
+		}
+
+		files = append(files, file)
 	}
 
-	if deletedFilesStr != "" {
-		deletedFilesList = strings.Split(deletedFilesStr, "\n")
+	return files, nil
+}
+
+// classifyFiles fills in the sizes and kind of every file by streaming the
+// blobs of both sides through a single `git cat-file --batch`.
+func (g *ExecGitService) classifyFiles(files []FileChange) error {
+	var hashes []string
+	for _, file := range files {
+		if file.OldHash != "" && file.OldMode != submoduleMode {
+			hashes = append(hashes, file.OldHash)
+		}
+		if file.NewHash != "" && file.NewMode != submoduleMode {
+			hashes = append(hashes, file.NewHash)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
 	}
 
-	return filesList, deletedFilesList, string(diff), nil
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to read staged blobs. %v", err)
+	}
+	defer func() {
+		// Reap git when the output was not read to the end
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	type blobInfo struct {
+		size int64
+		head []byte
+	}
+	blobs := make(map[string]blobInfo, len(hashes))
+
+	reader := bufio.NewReader(stdout)
+	for range hashes {
+		// Each object is "<sha> <type> <size>\n<content>\n"
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read staged blobs. %v", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("failed to read staged blobs. unexpected output: %q", header)
+		}
+
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to read staged blobs. %v", err)
+		}
+
+		head := make([]byte, min(size, classifyPeekSize))
+		if _, err := io.ReadFull(reader, head); err != nil {
+			return fmt.Errorf("failed to read staged blobs. %v", err)
+		}
+		if _, err := reader.Discard(int(size-int64(len(head))) + 1); err != nil {
+			return fmt.Errorf("failed to read staged blobs. %v", err)
+		}
+
+		blobs[fields[0]] = blobInfo{size, head}
+	}
+
+	for i := range files {
+		file := &files[i]
+		file.OldSize = blobs[file.OldHash].size
+		file.NewSize = blobs[file.NewHash].size
+		file.SizeKnown = true
+
+		if file.NewHash != "" && file.NewMode != submoduleMode {
+			blob := blobs[file.NewHash]
+			file.Kind = classifyFile(file.Path, blob.head, blob.size)
+		}
+	}
+
+	return nil
+}
+
+// loadSubmoduleLogs lists the commits between the old and new pointer of each
+// updated submodule. Submodules that are not checked out, or do not have the
+// commits fetched, are left without a log.
+func (g *ExecGitService) loadSubmoduleLogs(files []FileChange) error {
+	var repoRoot string
+	for i := range files {
+		file := &files[i]
+		if !file.IsSubmodule() || file.NewHash == "" {
+			continue
+		}
+
+		if repoRoot == "" {
+			var err error
+			if repoRoot, err = g.RepositoryRoot(); err != nil {
+				return err
+			}
+		}
+
+		revRange := file.NewHash
+		if file.OldHash != "" {
+			revRange = file.OldHash + ".." + file.NewHash
+		}
+
+		// One more commit than listed tells whether the log was capped
+		output, err := exec.Command(
+			"git", "-C", filepath.Join(repoRoot, file.Path),
+			"log", "--oneline", "--no-decorate",
+			fmt.Sprintf("--max-count=%d", maxSubmoduleLogEntries+1),
+			revRange,
+		).Output()
+		if err != nil {
+			continue
+		}
+
+		file.SubmoduleLogLoaded = true
+		if log := strings.TrimSpace(string(output)); log != "" {
+			file.SubmoduleLog = strings.Split(log, "\n")
+		}
+		if len(file.SubmoduleLog) > maxSubmoduleLogEntries {
+			file.SubmoduleLog = file.SubmoduleLog[:maxSubmoduleLogEntries]
+			file.SubmoduleLogCapped = true
+		}
+	}
+
+	return nil
+}
+
+// RecentCommitMessages returns the messages of the last limit non-merge
+// commits, newest first. author is a regular expression matched against
+// "Name <email>" as in `git log --author`, and paths are relative to the
+// repository root; both are optional.
+func (g *ExecGitService) RecentCommitMessages(
+	limit int,
+	author string,
+	paths []string,
+) ([]string, error) {
+	// A repository without commits has no history to learn from
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+		return nil, nil
+	}
+
+	args := []string{"log", "-z", "--no-merges", "--format=%B", fmt.Sprintf("--max-count=%d", limit)}
+	if author != "" {
+		args = append(args, "--author="+author)
+	}
+	args = append(args, "--")
+	for _, p := range paths {
+		args = append(args, ":(top)"+p)
+	}
+
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit history. %v", err)
+	}
+
+	var messages []string
+	for _, message := range strings.Split(string(output), "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// CurrentBranch returns the short name of the checked out branch, or an empty
+// string when HEAD is detached.
+func (g *ExecGitService) CurrentBranch() (string, error) {
+	output, err := exec.Command("git", "symbolic-ref", "--short", "--quiet", "HEAD").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read current branch. %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// RecentAuthors returns the "Name <email>" of everyone who authored one of
+// the last commits non-merge commits, most active first, like
+// `git shortlog -sne`.
+func (g *ExecGitService) RecentAuthors(commits int) ([]string, error) {
+	// A repository without commits has no authors
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+		return nil, nil
+	}
+
+	output, err := exec.Command(
+		"git", "shortlog", "-sne", "--no-merges",
+		fmt.Sprintf("--max-count=%d", commits),
+		"HEAD",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent authors. %v", err)
+	}
+
+	var authors []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Each line is "<count>\t<name> <email>"
+		if _, author, ok := strings.Cut(line, "\t"); ok {
+			authors = append(authors, author)
+		}
+	}
+
+	return authors, nil
+}
+
+// UserIdentity returns the configured "Name <email>" of the current user.
+func (g *ExecGitService) UserIdentity() (string, error) {
+	output, err := exec.Command("git", "var", "GIT_COMMITTER_IDENT").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read user identity. %v", err)
+	}
+
+	// The identity is followed by a timestamp and timezone
+	ident := string(output)
+	if idx := strings.LastIndex(ident, ">"); idx != -1 {
+		ident = ident[:idx+1]
+	}
+
+	return strings.TrimSpace(ident), nil
 }
 
 // DefaultLockFilePatterns returns common lock file patterns to exclude
@@ -159,7 +704,7 @@ func DefaultLockFilePatterns() []string {
 	}
 }
 
-func (g *GitService) CommitChanges(message string) error {
+func (g *ExecGitService) CommitChanges(message string) error {
 	output, err := exec.Command("git", "commit", "-m", message).Output()
 	if err != nil {
 		return fmt.Errorf("failed to commit changes. %v", err)
@@ -169,3 +714,164 @@ func (g *GitService) CommitChanges(message string) error {
 
 	return nil
 }
+
+// HeadCommit returns the full object name of the commit HEAD points to.
+func (g *ExecGitService) HeadCommit() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--verify", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD. %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ReadBlobs returns the content of the blobs with the given object names,
+// keyed by object name, streamed through a single `git cat-file --batch`.
+// Missing objects are left out.
+func (g *ExecGitService) ReadBlobs(hashes []string) (map[string][]byte, error) {
+	blobs := make(map[string][]byte, len(hashes))
+	if len(hashes) == 0 {
+		return blobs, nil
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to read blobs. %v", err)
+	}
+	defer func() {
+		// Reap git when the output was not read to the end
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for range hashes {
+		// Each object is "<sha> <type> <size>\n<content>\n", or
+		// "<name> missing\n"
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blobs. %v", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) == 2 && fields[1] == "missing" {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("failed to read blobs. unexpected output: %q", header)
+		}
+
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blobs. %v", err)
+		}
+
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("failed to read blobs. %v", err)
+		}
+		blobs[fields[0]] = content[:size]
+	}
+
+	return blobs, nil
+}
+
+// Editor returns the command of the editor to edit commit messages with,
+// resolved like git does: GIT_EDITOR, core.editor, VISUAL, EDITOR, then vi.
+func (g *ExecGitService) Editor() (string, error) {
+	output, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the editor. %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// resolveEditor resolves the editor like git does, given core.editor.
+func resolveEditor(coreEditor string) string {
+	for _, editor := range []string{os.Getenv("GIT_EDITOR"), coreEditor, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if editor != "" {
+			return editor
+		}
+	}
+
+	return "vi"
+}
+
+// GitDir returns the absolute path of the git directory of the current
+// repository or worktree.
+func (g *ExecGitService) GitDir() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CommentChar returns core.commentChar, the prefix of the comment lines of
+// message files, "#" when it is not set or set to "auto".
+func (g *ExecGitService) CommentChar() (string, error) {
+	output, err := exec.Command("git", "config", "--get", "core.commentChar").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return defaultCommentChar, nil
+		}
+		return "", fmt.Errorf("failed to read core.commentChar. %v", err)
+	}
+
+	return commentCharOrDefault(strings.TrimSpace(string(output))), nil
+}
+
+// commentCharOrDefault returns the configured comment character, falling
+// back to "#" for "auto", which picks one per message in git.
+func commentCharOrDefault(commentChar string) string {
+	if commentChar == "" || commentChar == "auto" {
+		return defaultCommentChar
+	}
+
+	return commentChar
+}
+
+// CommitTemplate returns the content of the `commit.template` file, or an
+// empty string when none is configured.
+func (g *ExecGitService) CommitTemplate() (string, error) {
+	output, err := exec.Command("git", "config", "--path", "--get", "commit.template").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read commit.template. %v", err)
+	}
+
+	root, err := g.RepositoryRoot()
+	if err != nil {
+		return "", err
+	}
+
+	return readCommitTemplate(strings.TrimSpace(string(output)), root)
+}
+
+// readCommitTemplate reads the template at path, which is relative to the
+// repository root when it is not absolute.
+func readCommitTemplate(path, root string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit template %s. %v", path, err)
+	}
+
+	return string(content), nil
+}
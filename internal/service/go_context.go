@@ -0,0 +1,272 @@
+package service
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SymbolChange is a top-level declaration touched by the changes of a file.
+type SymbolChange struct {
+	// Name is the declaration kind and name, e.g. "func Client.Do".
+	Name string
+	// Change is "added", "removed" or "modified".
+	Change string
+}
+
+func (s SymbolChange) String() string {
+	return fmt.Sprintf("%s (%s)", s.Name, s.Change)
+}
+
+var hunkRanges = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// goDecl is a top-level declaration of a Go file and the lines it spans,
+// doc comment included.
+type goDecl struct {
+	name       string
+	exported   bool
+	start, end int
+}
+
+// goFileDecls holds the declarations of both sides of a changed Go file.
+type goFileDecls struct {
+	old, new []goDecl
+}
+
+// EnrichGoContext names the top-level declarations each hunk of a Go file
+// touches in its hunk header, where git only puts the nearest line that looks
+// like a function, and records the exported ones in FileChange.Symbols.
+// readBlob reads both sides of the files from their hashes. Files that cannot
+// be read or parsed, e.g. because they do not compile, are left as is.
+func EnrichGoContext(changes *StagedChanges, readBlob func(hash string) ([]byte, error)) {
+	files := make(map[string]*goFileDecls)
+	for _, file := range changes.Files {
+		if !strings.HasSuffix(file.Path, ".go") || file.Status == StatusDeleted || file.Summarized() {
+			continue
+		}
+
+		decls := &goFileDecls{}
+		var ok bool
+		if decls.new, ok = parseGoDecls(file.NewHash, readBlob); !ok {
+			continue
+		}
+		if file.OldHash != "" {
+			if decls.old, ok = parseGoDecls(file.OldHash, readBlob); !ok {
+				continue
+			}
+		}
+		files[file.Path] = decls
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	symbols := make(map[string][]SymbolChange)
+	lines := strings.Split(changes.Diff, "\n")
+	var path string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			path = ""
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			path = patchPath(lines[i+1][4:], "b/")
+			i++
+		case strings.HasPrefix(line, "@@ ") && files[path] != nil:
+			match := hunkRanges.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			header := i
+			oldLine, newLine := atoi(match[1]), atoi(match[3])
+			oldCount, newCount := hunkCount(match[2]), hunkCount(match[4])
+			var oldTouched, newTouched []goDecl
+			for i+1 < len(lines) && (oldCount > 0 || newCount > 0) {
+				i++
+				hunkLine := lines[i]
+				switch {
+				case strings.HasPrefix(hunkLine, "\\"):
+				case strings.HasPrefix(hunkLine, "-"):
+					oldTouched = appendEnclosing(oldTouched, files[path].old, oldLine)
+					oldLine++
+					oldCount--
+				case strings.HasPrefix(hunkLine, "+"):
+					newTouched = appendEnclosing(newTouched, files[path].new, newLine)
+					newLine++
+					newCount--
+				default:
+					oldLine++
+					newLine++
+					oldCount--
+					newCount--
+				}
+			}
+
+			if names := touchedNames(oldTouched, newTouched); len(names) > 0 {
+				lines[header] = match[0] + " " + strings.Join(names, ", ")
+			}
+			symbols[path] = mergeSymbolChanges(symbols[path], oldTouched, newTouched, files[path])
+		}
+	}
+
+	changes.Diff = strings.Join(lines, "\n")
+	for i := range changes.Files {
+		changes.Files[i].Symbols = symbols[changes.Files[i].Path]
+	}
+}
+
+// parseGoDecls parses the top-level declarations of a blob, reporting false
+// when it cannot be read or parsed.
+func parseGoDecls(hash string, readBlob func(hash string) ([]byte, error)) ([]goDecl, bool) {
+	content, err := readBlob(hash)
+	if err != nil {
+		return nil, false
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+
+	var decls []goDecl
+	add := func(name string, exported bool, doc *ast.CommentGroup, node ast.Node) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		decls = append(decls, goDecl{
+			name:     name,
+			exported: exported,
+			start:    fset.Position(start).Line,
+			end:      fset.Position(node.End()).Line,
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name, exported := decl.Name.Name, decl.Name.IsExported()
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recv := receiverName(decl.Recv.List[0].Type)
+				name = recv + "." + name
+				exported = exported && token.IsExported(recv)
+			}
+			add("func "+name, exported, decl.Doc, decl)
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				// Specs of a parenthesized group span their own lines only
+				var node ast.Node = decl
+				doc := decl.Doc
+
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if decl.Lparen.IsValid() {
+						node, doc = spec, spec.Doc
+					}
+					add("type "+spec.Name.Name, spec.Name.IsExported(), doc, node)
+				case *ast.ValueSpec:
+					if decl.Lparen.IsValid() {
+						node, doc = spec, spec.Doc
+					}
+					names := make([]string, 0, len(spec.Names))
+					exported := false
+					for _, ident := range spec.Names {
+						names = append(names, ident.Name)
+						exported = exported || ident.IsExported()
+					}
+					add(decl.Tok.String()+" "+strings.Join(names, ", "), exported, doc, node)
+				}
+			}
+		}
+	}
+
+	return decls, true
+}
+
+// receiverName returns the type name of a method receiver, without pointer
+// and type parameters.
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	default:
+		return ""
+	}
+}
+
+// appendEnclosing adds the declaration spanning line to touched, once.
+func appendEnclosing(touched, decls []goDecl, line int) []goDecl {
+	for _, decl := range decls {
+		if line >= decl.start && line <= decl.end {
+			if !slices.Contains(touched, decl) {
+				touched = append(touched, decl)
+			}
+			break
+		}
+	}
+
+	return touched
+}
+
+// touchedNames lists the names of the declarations touched on either side of
+// a hunk, new side first.
+func touchedNames(oldTouched, newTouched []goDecl) []string {
+	var names []string
+	for _, decl := range append(slices.Clone(newTouched), oldTouched...) {
+		if !slices.Contains(names, decl.name) {
+			names = append(names, decl.name)
+		}
+	}
+
+	return names
+}
+
+// mergeSymbolChanges adds the exported declarations touched by a hunk to the
+// symbol changes of its file.
+func mergeSymbolChanges(
+	symbols []SymbolChange,
+	oldTouched, newTouched []goDecl,
+	decls *goFileDecls,
+) []SymbolChange {
+	hasDecl := func(decls []goDecl, name string) bool {
+		return slices.ContainsFunc(decls, func(decl goDecl) bool { return decl.name == name })
+	}
+
+	for _, decl := range append(slices.Clone(newTouched), oldTouched...) {
+		if !decl.exported || slices.ContainsFunc(symbols, func(s SymbolChange) bool { return s.Name == decl.name }) {
+			continue
+		}
+
+		change := "modified"
+		switch {
+		case !hasDecl(decls.old, decl.name):
+			change = "added"
+		case !hasDecl(decls.new, decl.name):
+			change = "removed"
+		}
+		symbols = append(symbols, SymbolChange{decl.name, change})
+	}
+
+	return symbols
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
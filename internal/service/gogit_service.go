@@ -0,0 +1,1439 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	utildiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// GoGitService implements GitService in-process on top of go-git, so no git
+// binary is required. Hooks are still executed as external programs.
+type GoGitService struct {
+	repo *git.Repository
+}
+
+func NewGoGitService() *GoGitService {
+	return &GoGitService{}
+}
+
+// NewGoGitServiceFromRepository wraps an already opened repository, e.g. one
+// created with git.Init(memory.NewStorage(), memfs.New()).
+func NewGoGitServiceFromRepository(repo *git.Repository) *GoGitService {
+	return &GoGitService{repo}
+}
+
+// repository opens the repository containing the current directory on first
+// use.
+func (g *GoGitService) repository() (*git.Repository, error) {
+	if g.repo != nil {
+		return g.repo, nil
+	}
+
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %v", err)
+	}
+	g.repo = repo
+
+	return repo, nil
+}
+
+func (g *GoGitService) worktree() (*git.Worktree, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree. %v", err)
+	}
+
+	return wt, nil
+}
+
+// RepositoryRoot returns the absolute path of the top-level directory of the
+// current repository.
+func (g *GoGitService) RepositoryRoot() (string, error) {
+	wt, err := g.worktree()
+	if err != nil {
+		return "", err
+	}
+
+	return wt.Filesystem.Root(), nil
+}
+
+func (g *GoGitService) VerifyGitInstallation() error {
+	return nil
+}
+
+func (g *GoGitService) VerifyGitRepository() error {
+	if _, err := g.worktree(); err != nil {
+		return fmt.Errorf(
+			"the current directory must be a git repository. %v",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// HasPreCommitHook checks if .git/hooks/pre-commit exists in the current repository.
+func (g *GoGitService) HasPreCommitHook() (bool, error) {
+	hookPath, err := g.PreCommitHookPath()
+	if err != nil {
+		return false, err
+	}
+
+	return hookPath != "", nil
+}
+
+// PreCommitHookPath returns the path to the pre-commit hook if it exists, or an empty string otherwise.
+// Repositories that are not stored on disk have no hooks to run.
+func (g *GoGitService) PreCommitHookPath() (string, error) {
+	wt, err := g.worktree()
+	if err != nil {
+		return "", err
+	}
+	if !onDisk(wt.Filesystem) {
+		return "", nil
+	}
+
+	gitDir, err := g.GitDir()
+	if err != nil {
+		return "", err
+	}
+
+	hookPath := filepath.Join(gitDir, "hooks", "pre-commit")
+	if info, err := os.Stat(hookPath); err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	return hookPath, nil
+}
+
+// IsExecutable checks if the given file is executable
+func (g *GoGitService) IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode().Perm()&0o111 != 0
+}
+
+// RunPreCommitHook executes the pre-commit hook and streams all output to the terminal
+func (g *GoGitService) RunPreCommitHook(path string) error {
+	cmd := exec.Command(path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// StageAll mirrors `git add -u`: every change to tracked files is staged,
+// untracked files are left alone.
+func (g *GoGitService) StageAll() error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("failed to update tracked files. %v", err)
+	}
+
+	for file, fileStatus := range status {
+		switch fileStatus.Worktree {
+		case git.Unmodified, git.Untracked:
+			continue
+		case git.Deleted:
+			_, err = wt.Remove(file)
+		default:
+			_, err = wt.Add(file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update tracked files. %v", err)
+		}
+	}
+
+	return nil
+}
+
+// StagedFiles returns the paths of staged files that still exist in the
+// index, i.e. everything but deletions. Paths are relative to the repository
+// root.
+func (g *GoGitService) StagedFiles() ([]string, error) {
+	changes, err := g.stagedChanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged files. %v", err)
+	}
+
+	var files []string
+	for _, change := range changes {
+		if change.to != nil {
+			files = append(files, change.path)
+		}
+	}
+
+	return files, nil
+}
+
+// HashWorkingTreeFiles returns the blob hash of the working tree content of
+// each given file. Files missing from the working tree are left out.
+func (g *GoGitService) HashWorkingTreeFiles(files []string) (map[string]string, error) {
+	wt, err := g.worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		f, err := wt.Filesystem.Open(file)
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash working tree files. %v", err)
+		}
+
+		hashes[file] = plumbing.ComputeHash(plumbing.BlobObject, content).String()
+	}
+
+	return hashes, nil
+}
+
+// IndexHashes returns the blob hash of each given file in the index. Files
+// missing from the index are left out.
+func (g *GoGitService) IndexHashes(files []string) (map[string]string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the index. %v", err)
+	}
+
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		if entry, err := idx.Entry(file); err == nil {
+			hashes[file] = entry.Hash.String()
+		}
+	}
+
+	return hashes, nil
+}
+
+// StageFiles adds the given files to the index.
+func (g *GoGitService) StageFiles(files []string) error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if _, err := wt.Add(file); err != nil {
+			return fmt.Errorf("failed to stage files. %v", err)
+		}
+	}
+
+	return nil
+}
+
+// UnstagedChanges lists the changes of the working tree that are not staged,
+// untracked files included, across the whole repository.
+func (g *GoGitService) UnstagedChanges() ([]UnstagedFile, error) {
+	wt, err := g.worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unstaged changes. %v", err)
+	}
+
+	idx, err := g.repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the index. %v", err)
+	}
+
+	paths := make([]string, 0, len(status))
+	for path := range status {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var files []UnstagedFile
+	for _, path := range paths {
+		switch status[path].Worktree {
+		case git.Untracked:
+			head, err := readWorktreeFileHead(wt, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list untracked files. %v", err)
+			}
+			files = append(files, UnstagedFile{Path: path, Status: StatusAdded, Binary: isBinary(head)})
+		case git.Deleted:
+			files = append(files, UnstagedFile{Path: path, Status: StatusDeleted})
+		case git.Modified:
+			file, err := g.unstagedModification(wt, idx, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list unstaged changes. %v", err)
+			}
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// unstagedModification diffs the index and working tree content of a file.
+func (g *GoGitService) unstagedModification(
+	wt *git.Worktree,
+	idx *index.Index,
+	path string,
+) (UnstagedFile, error) {
+	file := UnstagedFile{Path: path, Status: StatusModified}
+
+	entry, err := idx.Entry(path)
+	if err != nil {
+		return file, err
+	}
+	from := &stagedEntry{path, entry.Hash, entry.Mode}
+	src, srcBinary, err := g.entryContent(from)
+	if err != nil {
+		return file, err
+	}
+
+	dst, err := readWorktreeFile(wt, path)
+	if err != nil {
+		return file, err
+	}
+
+	if srcBinary || isBinary(dst) {
+		file.Binary = true
+		return file, nil
+	}
+
+	to := &stagedEntry{path, plumbing.ComputeHash(plumbing.BlobObject, dst), entry.Mode}
+	patch := &stagedFilePatch{from: from, to: to, chunks: diffChunks(src, string(dst))}
+
+	var diff bytes.Buffer
+	encoder := fdiff.NewUnifiedEncoder(&diff, fdiff.DefaultContextLines)
+	if err := encoder.Encode(&stagedPatch{[]fdiff.FilePatch{patch}}); err != nil {
+		return file, err
+	}
+
+	parsed, err := parseUnstagedDiff(diff.String())
+	if err != nil {
+		return file, err
+	}
+	if len(parsed) > 0 {
+		file.Hunks = parsed[0].Hunks
+	}
+
+	return file, nil
+}
+
+func readWorktreeFile(wt *git.Worktree, path string) ([]byte, error) {
+	f, err := wt.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// readWorktreeFileHead reads the first bytes of a working tree file, enough
+// to tell whether it is binary.
+func readWorktreeFileHead(wt *git.Worktree, path string) ([]byte, error) {
+	f, err := wt.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, binaryPeekSize))
+}
+
+// StageHunks stages some of the hunks of a modified file, like
+// `git add --patch` does, by writing the index content with the hunks
+// applied as a new blob.
+func (g *GoGitService) StageHunks(path string, hunks []Hunk) error {
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	repo, err := g.repository()
+	if err != nil {
+		return err
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read the index. %v", err)
+	}
+
+	entry, err := idx.Entry(path)
+	if err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	content, _, err := g.entryContent(&stagedEntry{path, entry.Hash, entry.Mode})
+	if err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	staged, err := applyHunks(content, hunks)
+	if err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(staged)))
+	writer, err := obj.Writer()
+	if err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+	if _, err := io.WriteString(writer, staged); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	// Clearing the cached stat makes git compare the content again
+	entry.Hash = hash
+	entry.Size = uint32(len(staged))
+	entry.ModifiedAt = time.Time{}
+	entry.CreatedAt = time.Time{}
+
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to stage hunks of %s. %v", path, err)
+	}
+
+	return nil
+}
+
+func (g *GoGitService) DetectDiffChanges() (*StagedChanges, error) {
+	headEntries, err := g.headEntries()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	changes, err := g.diffIndex(headEntries)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	changes, err = g.detectRenames(changes)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	prefix, err := g.currentDirPrefix()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	var files, lockFiles []FileChange
+	var filePatches []fdiff.FilePatch
+
+	for _, change := range changes {
+		if !strings.HasPrefix(change.path, prefix) {
+			continue
+		}
+
+		file := change.fileChange()
+		if err := g.classify(&file, change); err != nil {
+			fmt.Println("Error:", err)
+			return nil, err
+		}
+		if matchesAnyPattern(file.Path, DefaultLockFilePatterns()) {
+			file.Kind = KindLockFile
+			lockFiles = append(lockFiles, file)
+			continue
+		}
+		if file.IsSubmodule() && file.NewHash != "" {
+			g.loadSubmoduleLog(&file)
+		}
+
+		files = append(files, file)
+		if change.to == nil || file.Summarized() {
+			continue
+		}
+
+		filePatch, err := g.filePatch(change)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return nil, err
+		}
+		filePatches = append(filePatches, filePatch)
+	}
+
+	// Check if we have any changes at all
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nothing to be analyzed")
+	}
+
+	var diff bytes.Buffer
+	encoder := fdiff.NewUnifiedEncoder(&diff, fdiff.DefaultContextLines)
+	if err := encoder.Encode(&stagedPatch{filePatches}); err != nil {
+		fmt.Println("Error:", err)
+		return nil, err
+	}
+
+	return &StagedChanges{Files: files, Diff: diff.String(), LockFiles: lockFiles}, nil
+}
+
+func (g *GoGitService) CommitChanges(message string) error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+
+	hash, err := wt.Commit(message, &git.CommitOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to commit changes. %v", err)
+	}
+
+	branch := "HEAD"
+	if head, err := g.repo.Head(); err == nil && head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	fmt.Printf("[%s %s] %s\n\n", branch, hash.String()[:7], subject)
+
+	return nil
+}
+
+// HeadCommit returns the full object name of the commit HEAD points to.
+func (g *GoGitService) HeadCommit() (string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD. %v", err)
+	}
+
+	return head.Hash().String(), nil
+}
+
+// ReadBlobs returns the content of the blobs with the given object names,
+// keyed by object name. Missing objects are left out.
+func (g *GoGitService) ReadBlobs(hashes []string) (map[string][]byte, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string][]byte, len(hashes))
+	for _, hash := range hashes {
+		blob, err := repo.BlobObject(plumbing.NewHash(hash))
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob %s. %v", hash, err)
+		}
+
+		content, err := readBlobContent(blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob %s. %v", hash, err)
+		}
+		blobs[hash] = content
+	}
+
+	return blobs, nil
+}
+
+// readBlobContent reads the whole content of blob.
+func readBlobContent(blob *object.Blob) ([]byte, error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// Editor returns the command of the editor to edit commit messages with,
+// resolved like git does: GIT_EDITOR, core.editor, VISUAL, EDITOR, then vi.
+func (g *GoGitService) Editor() (string, error) {
+	editor, err := g.configOption("core", "editor")
+	if err != nil {
+		return "", err
+	}
+
+	return resolveEditor(editor), nil
+}
+
+// CommentChar returns core.commentChar, the prefix of the comment lines of
+// message files, "#" when it is not set or set to "auto".
+func (g *GoGitService) CommentChar() (string, error) {
+	commentChar, err := g.configOption("core", "commentChar")
+	if err != nil {
+		return "", err
+	}
+
+	return commentCharOrDefault(commentChar), nil
+}
+
+// GitDir returns the absolute path of the git directory of the current
+// repository or worktree.
+func (g *GoGitService) GitDir() (string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return "", err
+	}
+
+	if storage, ok := repo.Storer.(*filesystem.Storage); ok {
+		return storage.Filesystem().Root(), nil
+	}
+
+	root, err := g.RepositoryRoot()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, ".git"), nil
+}
+
+// CommitTemplate returns the content of the `commit.template` file, or an
+// empty string when none is configured.
+func (g *GoGitService) CommitTemplate() (string, error) {
+	path, err := g.configOption("commit", "template")
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to read commit.template. %v", err)
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	root, err := g.RepositoryRoot()
+	if err != nil {
+		return "", err
+	}
+
+	return readCommitTemplate(path, root)
+}
+
+// configOption returns the value of a raw configuration option, looked up in
+// the repository, global then system configuration like git does, or an
+// empty string when it is not set.
+func (g *GoGitService) configOption(section, key string) (string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return "", err
+	}
+
+	local, err := repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to read git config. %v", err)
+	}
+	configs := []*config.Config{local}
+	for _, scope := range []config.Scope{config.GlobalScope, config.SystemScope} {
+		cfg, err := config.LoadConfig(scope)
+		if err != nil {
+			return "", fmt.Errorf("failed to read git config. %v", err)
+		}
+		configs = append(configs, cfg)
+	}
+
+	for _, cfg := range configs {
+		if cfg.Raw.HasSection(section) && cfg.Raw.Section(section).HasOption(key) {
+			return cfg.Raw.Section(section).Option(key), nil
+		}
+	}
+
+	return "", nil
+}
+
+// RecentCommitMessages returns the messages of the last limit non-merge
+// commits, newest first. author is a regular expression matched against
+// "Name <email>" as in `git log --author`, and paths are relative to the
+// repository root; both are optional.
+func (g *GoGitService) RecentCommitMessages(
+	limit int,
+	author string,
+	paths []string,
+) ([]string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	var authorRegexp *regexp.Regexp
+	if author != "" {
+		if authorRegexp, err = regexp.Compile(author); err != nil {
+			return nil, fmt.Errorf("invalid author filter. %v", err)
+		}
+	}
+
+	opts := &git.LogOptions{}
+	if len(paths) > 0 {
+		opts.PathFilter = func(file string) bool {
+			return matchesAnyPathspec(file, paths)
+		}
+	}
+
+	iter, err := repo.Log(opts)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// A repository without commits has no history to learn from
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit history. %v", err)
+	}
+	defer iter.Close()
+
+	var messages []string
+	for len(messages) < limit {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit history. %v", err)
+		}
+
+		if commit.NumParents() > 1 {
+			continue
+		}
+		if authorRegexp != nil &&
+			!authorRegexp.MatchString(fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)) {
+			continue
+		}
+
+		if message := strings.TrimSpace(commit.Message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// CurrentBranch returns the short name of the checked out branch, or an empty
+// string when HEAD is detached.
+func (g *GoGitService) CurrentBranch() (string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return "", err
+	}
+
+	// Not resolved, so an unborn branch still has a name
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to read current branch. %v", err)
+	}
+
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", nil
+	}
+
+	return head.Target().Short(), nil
+}
+
+// RecentAuthors returns the "Name <email>" of everyone who authored one of
+// the last commits non-merge commits, most active first, like
+// `git shortlog -sne`.
+func (g *GoGitService) RecentAuthors(commits int) ([]string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := repo.Log(&git.LogOptions{})
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// A repository without commits has no authors
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent authors. %v", err)
+	}
+	defer iter.Close()
+
+	counts := make(map[string]int)
+	var authors []string
+	for seen := 0; seen < commits; {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recent authors. %v", err)
+		}
+		if commit.NumParents() > 1 {
+			continue
+		}
+		seen++
+
+		author := fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+		if counts[author] == 0 {
+			authors = append(authors, author)
+		}
+		counts[author]++
+	}
+
+	sort.SliceStable(authors, func(i, j int) bool {
+		if counts[authors[i]] != counts[authors[j]] {
+			return counts[authors[i]] > counts[authors[j]]
+		}
+		return authors[i] < authors[j]
+	})
+
+	return authors, nil
+}
+
+// UserIdentity returns the configured "Name <email>" of the current user.
+func (g *GoGitService) UserIdentity() (string, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", fmt.Errorf("failed to read user identity. %v", err)
+	}
+	if cfg.User.Name == "" || cfg.User.Email == "" {
+		return "", fmt.Errorf("failed to read user identity. user.name and user.email must be set")
+	}
+
+	return fmt.Sprintf("%s <%s>", cfg.User.Name, cfg.User.Email), nil
+}
+
+// stagedEntry is a file as recorded in either HEAD or the index.
+type stagedEntry struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (e *stagedEntry) Hash() plumbing.Hash     { return e.hash }
+func (e *stagedEntry) Mode() filemode.FileMode { return e.mode }
+func (e *stagedEntry) Path() string            { return e.path }
+
+// stagedChange is a path whose index entry differs from HEAD. from is nil for
+// added files and to is nil for deleted files. For renames and copies from
+// holds the source path.
+type stagedChange struct {
+	path       string
+	from, to   *stagedEntry
+	similarity int
+	copied     bool
+}
+
+func (c stagedChange) fileChange() FileChange {
+	file := FileChange{Path: c.path}
+	if c.from != nil {
+		file.OldMode = formatMode(c.from.mode)
+		file.OldHash = c.from.hash.String()
+	}
+	if c.to != nil {
+		file.NewMode = formatMode(c.to.mode)
+		file.NewHash = c.to.hash.String()
+	}
+
+	switch {
+	case c.from == nil:
+		file.Status = StatusAdded
+	case c.to == nil:
+		file.Status = StatusDeleted
+	case c.from.path != c.to.path:
+		file.Status = StatusRenamed
+		if c.copied {
+			file.Status = StatusCopied
+		}
+		file.OldPath = c.from.path
+		file.Similarity = c.similarity
+	case modeType(c.from.mode) != modeType(c.to.mode):
+		file.Status = StatusTypeChanged
+	default:
+		file.Status = StatusModified
+	}
+
+	return file
+}
+
+// stagedChanges compares the index against the HEAD tree, the in-process
+// equivalent of `git diff --cached --no-renames`. Changes are sorted by path.
+func (g *GoGitService) stagedChanges() ([]stagedChange, error) {
+	headEntries, err := g.headEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	return g.diffIndex(headEntries)
+}
+
+// diffIndex compares the index against the given HEAD entries.
+func (g *GoGitService) diffIndex(headEntries map[string]*stagedEntry) ([]stagedChange, error) {
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []stagedChange
+	indexed := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		indexed[e.Name] = true
+
+		to := &stagedEntry{e.Name, e.Hash, e.Mode}
+		from, ok := headEntries[e.Name]
+		if !ok {
+			changes = append(changes, stagedChange{path: e.Name, to: to})
+			continue
+		}
+		if from.hash != to.hash || from.mode != to.mode {
+			changes = append(changes, stagedChange{path: e.Name, from: from, to: to})
+		}
+	}
+
+	for name, from := range headEntries {
+		if !indexed[name] {
+			changes = append(changes, stagedChange{path: name, from: from})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+
+	return changes, nil
+}
+
+// renameThreshold is the minimum similarity for an added and a deleted file
+// to be reported as a rename, matching git's default of 50%.
+const renameThreshold = 50
+
+// maxRenameCandidates bounds the number of added x deleted pairs compared for
+// inexact renames, like git's diff.renameLimit.
+const maxRenameCandidates = 1000
+
+// detectRenames pairs added files with deleted files into renames, and
+// added files identical to a file modified in the same changeset into copies,
+// the in-process equivalent of `git diff -M -C`.
+func (g *GoGitService) detectRenames(changes []stagedChange) ([]stagedChange, error) {
+	var added, deleted, modified []int
+	for i, change := range changes {
+		switch {
+		case change.from == nil:
+			added = append(added, i)
+		case change.to == nil:
+			deleted = append(deleted, i)
+		default:
+			modified = append(modified, i)
+		}
+	}
+
+	paired := make(map[int]bool)
+	pair := func(addIdx, delIdx, similarity int) {
+		changes[addIdx].from = changes[delIdx].from
+		changes[addIdx].similarity = similarity
+		paired[addIdx] = true
+		paired[delIdx] = true
+	}
+
+	// Exact renames first, they are cheap and unambiguous.
+	for _, a := range added {
+		for _, d := range deleted {
+			if !paired[d] && changes[a].to.hash == changes[d].from.hash {
+				pair(a, d, 100)
+				break
+			}
+		}
+	}
+
+	if len(added)*len(deleted) <= maxRenameCandidates {
+		type candidate struct{ add, del, score int }
+		var candidates []candidate
+		for _, a := range added {
+			for _, d := range deleted {
+				if paired[a] || paired[d] {
+					continue
+				}
+				score, err := g.similarity(changes[d].from, changes[a].to)
+				if err != nil {
+					return nil, err
+				}
+				if score >= renameThreshold {
+					candidates = append(candidates, candidate{a, d, score})
+				}
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+		for _, c := range candidates {
+			if !paired[c.add] && !paired[c.del] {
+				pair(c.add, c.del, c.score)
+			}
+		}
+	}
+
+	// Exact copies of the pre-image of modified files.
+	for _, a := range added {
+		if paired[a] {
+			continue
+		}
+		for _, m := range modified {
+			if changes[m].from.hash == changes[a].to.hash {
+				changes[a].from = changes[m].from
+				changes[a].similarity = 100
+				changes[a].copied = true
+				break
+			}
+		}
+	}
+
+	result := changes[:0]
+	for i, change := range changes {
+		if change.to == nil && paired[i] {
+			continue
+		}
+		result = append(result, change)
+	}
+
+	return result, nil
+}
+
+// similarity returns how much of two blobs is shared, as git computes it:
+// the bytes common to both divided by the size of the larger one.
+func (g *GoGitService) similarity(from, to *stagedEntry) (int, error) {
+	if modeType(from.mode) != modeType(to.mode) {
+		return 0, nil
+	}
+
+	src, _, err := g.entryContent(from)
+	if err != nil {
+		return 0, err
+	}
+	dst, _, err := g.entryContent(to)
+	if err != nil {
+		return 0, err
+	}
+
+	size := max(len(src), len(dst))
+	if size == 0 {
+		return 100, nil
+	}
+
+	common := 0
+	for _, d := range utildiff.Do(src, dst) {
+		if d.Type == diffmatchpatch.DiffEqual {
+			common += len(d.Text)
+		}
+	}
+
+	return common * 100 / size, nil
+}
+
+// formatMode renders a file mode the way git prints it, e.g. "100644".
+func formatMode(mode filemode.FileMode) string {
+	return fmt.Sprintf("%06o", uint32(mode))
+}
+
+// modeType groups file modes by object type, so a permission change is not
+// mistaken for a type change.
+func modeType(mode filemode.FileMode) string {
+	switch mode {
+	case filemode.Symlink:
+		return "symlink"
+	case filemode.Submodule:
+		return "submodule"
+	default:
+		return "file"
+	}
+}
+
+// headEntries returns every non-directory entry of the HEAD tree keyed by
+// path. An unborn HEAD yields no entries.
+func (g *GoGitService) headEntries() (map[string]*stagedEntry, error) {
+	entries := make(map[string]*stagedEntry)
+
+	repo, err := g.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		entries[name] = &stagedEntry{name, entry.Hash, entry.Mode}
+	}
+
+	return entries, nil
+}
+
+// currentDirPrefix returns the current directory relative to the worktree
+// root, with a trailing slash, so diffs are scoped like `git diff -- .`.
+// Diffs are not scoped when the worktree is not on disk or the current
+// directory is outside of it.
+func (g *GoGitService) currentDirPrefix() (string, error) {
+	wt, err := g.worktree()
+	if err != nil {
+		return "", err
+	}
+	if !onDisk(wt.Filesystem) {
+		return "", nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(wt.Filesystem.Root(), cwd)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", nil
+	}
+
+	return filepath.ToSlash(rel) + "/", nil
+}
+
+// onDisk tells whether fs is backed by the OS filesystem rather than, for
+// instance, held in memory.
+func onDisk(fs billy.Basic) bool {
+	// Filesystems like chroot and polyfill wrap the one that stores files
+	for {
+		wrapper, ok := fs.(interface{ Underlying() billy.Basic })
+		if !ok {
+			break
+		}
+		fs = wrapper.Underlying()
+	}
+
+	switch fs.(type) {
+	case *osfs.ChrootOS, *osfs.BoundOS:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *GoGitService) filePatch(change stagedChange) (fdiff.FilePatch, error) {
+	patch := &stagedFilePatch{}
+	if change.from != nil {
+		patch.from = change.from
+	}
+	if change.to != nil {
+		patch.to = change.to
+	}
+
+	src, srcBinary, err := g.entryContent(change.from)
+	if err != nil {
+		return nil, err
+	}
+	dst, dstBinary, err := g.entryContent(change.to)
+	if err != nil {
+		return nil, err
+	}
+
+	if srcBinary || dstBinary {
+		patch.binary = true
+		return patch, nil
+	}
+
+	patch.chunks = diffChunks(src, dst)
+
+	return patch, nil
+}
+
+// diffChunks computes the line diff between two contents.
+func diffChunks(src, dst string) []fdiff.Chunk {
+	var chunks []fdiff.Chunk
+	for _, d := range utildiff.Do(src, dst) {
+		var op fdiff.Operation
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			op = fdiff.Equal
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, &stagedChunk{d.Text, op})
+	}
+
+	return chunks
+}
+
+// classify fills in the sizes and kind of a file from its blobs.
+func (g *GoGitService) classify(file *FileChange, change stagedChange) error {
+	var err error
+	if change.from != nil && change.from.mode != filemode.Submodule {
+		if file.OldSize, _, err = g.blobHead(change.from.hash); err != nil {
+			return err
+		}
+	}
+
+	if change.to != nil && change.to.mode != filemode.Submodule {
+		var head []byte
+		if file.NewSize, head, err = g.blobHead(change.to.hash); err != nil {
+			return err
+		}
+		file.Kind = classifyFile(file.Path, head, file.NewSize)
+	}
+	file.SizeKnown = true
+
+	return nil
+}
+
+// loadSubmoduleLog lists the commits of `git log old..new` in the submodule
+// of file, which is left without a log when it is not checked out or does
+// not have both commits fetched.
+func (g *GoGitService) loadSubmoduleLog(file *FileChange) {
+	wt, err := g.worktree()
+	if err != nil {
+		return
+	}
+
+	if !onDisk(wt.Filesystem) {
+		return
+	}
+
+	subRepo, err := git.PlainOpen(filepath.Join(wt.Filesystem.Root(), file.Path))
+	if err != nil {
+		return
+	}
+
+	newCommit, err := subRepo.CommitObject(plumbing.NewHash(file.NewHash))
+	if err != nil {
+		return
+	}
+
+	// Commits reachable from old are left out, as with old..new, so that
+	// rewinds and merges are listed the way git does
+	excluded := make(map[plumbing.Hash]bool)
+	if file.OldHash != "" {
+		oldCommit, err := subRepo.CommitObject(plumbing.NewHash(file.OldHash))
+		if err != nil {
+			return
+		}
+		err = object.NewCommitPreorderIter(oldCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+			excluded[commit.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	iter := object.NewCommitIterCTime(newCommit, excluded, nil)
+	defer iter.Close()
+
+	var log []string
+	for {
+		commit, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return
+		}
+		if len(log) == maxSubmoduleLogEntries {
+			file.SubmoduleLogCapped = true
+			break
+		}
+
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		log = append(log, fmt.Sprintf("%s %s", ShortHash(commit.Hash.String()), subject))
+	}
+
+	file.SubmoduleLog, file.SubmoduleLogLoaded = log, true
+}
+
+// blobHead returns the size of a blob and its first classifyPeekSize bytes.
+func (g *GoGitService) blobHead(hash plumbing.Hash) (int64, []byte, error) {
+	blob, err := g.repo.BlobObject(hash)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer reader.Close()
+
+	head, err := io.ReadAll(io.LimitReader(reader, classifyPeekSize))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return blob.Size, head, nil
+}
+
+// entryContent returns the content of a blob, or git's textual
+// representation of a submodule commit, and whether it looks binary.
+func (g *GoGitService) entryContent(entry *stagedEntry) (string, bool, error) {
+	if entry == nil {
+		return "", false, nil
+	}
+
+	if entry.mode == filemode.Submodule {
+		return fmt.Sprintf("Subproject commit %s\n", entry.hash), false, nil
+	}
+
+	blob, err := g.repo.BlobObject(entry.hash)
+	if err != nil {
+		return "", false, err
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(content), isBinary(content), nil
+}
+
+// matchesAnyPattern reports whether file matches one of the exclusion
+// patterns. A leading "**/" matches the base name at any depth.
+func matchesAnyPattern(file string, patterns []string) bool {
+	for _, pattern := range patterns {
+		target := file
+		if strings.HasPrefix(pattern, "**/") {
+			pattern = strings.TrimPrefix(pattern, "**/")
+			target = path.Base(file)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAnyPathspec reports whether file is one of the given paths, lies
+// below one of them, or matches one of them as a glob.
+func matchesAnyPathspec(file string, pathspecs []string) bool {
+	for _, spec := range pathspecs {
+		spec = strings.TrimSuffix(spec, "/")
+		if file == spec || strings.HasPrefix(file, spec+"/") {
+			return true
+		}
+		if ok, _ := path.Match(spec, file); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stagedPatch adapts the staged changes to go-git's unified diff encoder.
+type stagedPatch struct {
+	filePatches []fdiff.FilePatch
+}
+
+func (p *stagedPatch) FilePatches() []fdiff.FilePatch { return p.filePatches }
+func (p *stagedPatch) Message() string                { return "" }
+
+type stagedFilePatch struct {
+	from, to fdiff.File
+	chunks   []fdiff.Chunk
+	binary   bool
+}
+
+func (p *stagedFilePatch) IsBinary() bool               { return p.binary }
+func (p *stagedFilePatch) Files() (from, to fdiff.File) { return p.from, p.to }
+func (p *stagedFilePatch) Chunks() []fdiff.Chunk        { return p.chunks }
+
+type stagedChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c *stagedChunk) Content() string       { return c.content }
+func (c *stagedChunk) Type() fdiff.Operation { return c.op }
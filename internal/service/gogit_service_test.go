@@ -0,0 +1,154 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func newMemoryGitService(t *testing.T) (*GoGitService, billy.Filesystem) {
+	t.Helper()
+
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatalf("git.Init() error = %v", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("repo.Config() error = %v", err)
+	}
+	cfg.User.Name, cfg.User.Email = "Test", "test@example.com"
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("repo.SetConfig() error = %v", err)
+	}
+
+	return NewGoGitServiceFromRepository(repo), fs
+}
+
+func writeFile(t *testing.T, fs billy.Filesystem, name, content string) {
+	t.Helper()
+
+	if err := util.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile(%s) error = %v", name, err)
+	}
+}
+
+func TestGoGitServiceInMemory(t *testing.T) {
+	g, fs := newMemoryGitService(t)
+
+	if hookPath, err := g.PreCommitHookPath(); err != nil || hookPath != "" {
+		t.Fatalf("PreCommitHookPath() = %q, %v, want no hook", hookPath, err)
+	}
+
+	writeFile(t, fs, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, fs, "logo.png", "\x89PNG\x00\x00")
+	writeFile(t, fs, "go.sum", "example.com/mod v1.0.0 h1:abc=\n")
+	writeFile(t, fs, "vendor/empty.go", "")
+	if err := g.StageFiles([]string{"main.go", "logo.png", "go.sum", "vendor/empty.go"}); err != nil {
+		t.Fatalf("StageFiles() error = %v", err)
+	}
+
+	changes, err := g.DetectDiffChanges()
+	if err != nil {
+		t.Fatalf("DetectDiffChanges() error = %v", err)
+	}
+	kinds := make(map[string]FileKind)
+	for _, file := range changes.Files {
+		if file.Status != StatusAdded {
+			t.Errorf("status of %s = %q, want %q", file.Path, file.Status, StatusAdded)
+		}
+		kinds[file.Path] = file.Kind
+	}
+	if len(kinds) != 3 || kinds["main.go"] != KindText || kinds["logo.png"] != KindBinary ||
+		kinds["vendor/empty.go"] != KindVendored {
+		t.Errorf("DetectDiffChanges() files = %v, want main.go as text, logo.png as binary and vendor/empty.go as vendored", kinds)
+	}
+	if summary := changes.Summary(); !strings.Contains(summary, "vendor/empty.go: vendored, 0 B (new)") {
+		t.Errorf("Summary() = %q, want the size of vendor/empty.go", summary)
+	}
+	if !strings.Contains(changes.Diff, "+func main() {}") || strings.Contains(changes.Diff, "logo.png") {
+		t.Errorf("DetectDiffChanges() diff = %q, want main.go only", changes.Diff)
+	}
+	if len(changes.LockFiles) != 1 || changes.LockFiles[0].Path != "go.sum" || changes.LockFiles[0].Kind != KindLockFile {
+		t.Errorf("DetectDiffChanges() lock files = %v, want go.sum", changes.LockFiles)
+	}
+
+	if err := g.CommitChanges("feat: add the entry point"); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+	assertHeadMessage(t, g, "feat: add the entry point")
+
+	writeFile(t, fs, "main.go", "package main\n\nfunc main() { println() }\n")
+	if err := fs.Remove("logo.png"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := fs.Remove("go.sum"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := fs.Symlink("main.go", "go.sum"); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	writeFile(t, fs, "untracked.txt", "left alone\n")
+	if err := g.StageAll(); err != nil {
+		t.Fatalf("StageAll() error = %v", err)
+	}
+
+	staged, err := g.StagedFiles()
+	if err != nil {
+		t.Fatalf("StagedFiles() error = %v", err)
+	}
+	if strings.Join(staged, ",") != "go.sum,main.go" {
+		t.Errorf("StagedFiles() = %v, want [go.sum main.go]", staged)
+	}
+
+	changes, err = g.DetectDiffChanges()
+	if err != nil {
+		t.Fatalf("DetectDiffChanges() error = %v", err)
+	}
+	statuses := make(map[string]ChangeStatus)
+	for _, file := range changes.Files {
+		statuses[file.Path] = file.Status
+	}
+	if len(statuses) != 2 || statuses["main.go"] != StatusModified || statuses["logo.png"] != StatusDeleted {
+		t.Errorf("DetectDiffChanges() statuses = %v, want main.go modified and logo.png deleted", statuses)
+	}
+
+	if err := g.CommitChanges("fix: print a blank line"); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+	assertHeadMessage(t, g, "fix: print a blank line")
+}
+
+func TestOnDisk(t *testing.T) {
+	if !onDisk(osfs.New(t.TempDir())) {
+		t.Error("onDisk(osfs) = false, want true")
+	}
+	if onDisk(memfs.New()) {
+		t.Error("onDisk(memfs) = true, want false")
+	}
+}
+
+func assertHeadMessage(t *testing.T, g *GoGitService, want string) {
+	t.Helper()
+
+	head, err := g.HeadCommit()
+	if err != nil {
+		t.Fatalf("HeadCommit() error = %v", err)
+	}
+	commit, err := g.repo.CommitObject(plumbing.NewHash(head))
+	if err != nil {
+		t.Fatalf("CommitObject() error = %v", err)
+	}
+	if commit.Message != want {
+		t.Errorf("HEAD message = %q, want %q", commit.Message, want)
+	}
+}
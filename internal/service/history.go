@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// HistoryOutcome is what became of a generation session.
+type HistoryOutcome string
+
+const (
+	// OutcomePending sessions are still running, or were interrupted.
+	OutcomePending   HistoryOutcome = "pending"
+	OutcomeCommitted HistoryOutcome = "committed"
+	OutcomeCancelled HistoryOutcome = "cancelled"
+)
+
+// HistoryEntry is a generation session: every message generated for a set of
+// staged changes and what became of them.
+type HistoryEntry struct {
+	ID            string    `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Repo          string    `json:"repo"`
+	Branch        string    `json:"branch,omitempty"`
+	DiffHash      string    `json:"diff_hash"`
+	Model         string    `json:"model"`
+	PromptVersion int       `json:"prompt_version"`
+	// Candidates are the generated messages, oldest first.
+	Candidates []string `json:"candidates"`
+	// FinalMessage is the last message shown to the user, edits included.
+	FinalMessage string `json:"final_message,omitempty"`
+	// Clue is the last clue the model was given.
+	Clue    string         `json:"clue,omitempty"`
+	Outcome HistoryOutcome `json:"outcome"`
+}
+
+// NewHistoryEntry starts a pending session.
+func NewHistoryEntry() *HistoryEntry {
+	now := time.Now()
+
+	return &HistoryEntry{
+		ID:            strconv.FormatInt(now.UnixNano(), 36),
+		Timestamp:     now,
+		PromptVersion: PromptVersion,
+		Outcome:       OutcomePending,
+	}
+}
+
+// maxHistoryEntries bounds how many sessions the history file keeps.
+const maxHistoryEntries = 500
+
+// HistoryService stores generation sessions in a JSONL file, one line per
+// session. Sessions are saved again whenever they change, so that nothing is
+// lost if geminicommit is interrupted.
+type HistoryService struct {
+	path string
+}
+
+func NewHistoryService(path string) *HistoryService {
+	return &HistoryService{path}
+}
+
+// DefaultHistoryPath returns the history file in the geminicommit config
+// directory.
+func DefaultHistoryPath() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(config, "geminicommit", "history.jsonl"), nil
+}
+
+// Save records the current state of entry in the history file, replacing
+// its previous state, and drops the oldest sessions beyond
+// maxHistoryEntries. The file is replaced as a whole, so an interruption
+// leaves either the previous or the new history.
+func (h *HistoryService) Save(entry *HistoryEntry) error {
+	entries, err := h.Entries()
+	if err != nil {
+		return err
+	}
+
+	if i := slices.IndexFunc(entries, func(e HistoryEntry) bool { return e.ID == entry.ID }); i != -1 {
+		entries[i] = *entry
+	} else {
+		entries = slices.Insert(entries, 0, *entry)
+	}
+	if len(entries) > maxHistoryEntries {
+		entries = entries[:maxHistoryEntries]
+	}
+
+	// The file is kept oldest first
+	var content bytes.Buffer
+	for i := len(entries) - 1; i >= 0; i-- {
+		line, err := json.Marshal(entries[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode history entry. %v", err)
+		}
+		content.Write(append(line, '\n'))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to make history dir. %v", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(h.path), ".history-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to write history file. %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file. %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history file. %v", err)
+	}
+	if err := os.Rename(file.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to write history file. %v", err)
+	}
+
+	return nil
+}
+
+// Entries returns the saved sessions, newest first.
+func (h *HistoryService) Entries() ([]HistoryEntry, error) {
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file. %v", err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	index := make(map[string]int)
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry HistoryEntry
+			// A line cut short by a crash is skipped rather than failing
+			// the whole history
+			if json.Unmarshal(line, &entry) == nil && entry.ID != "" {
+				if i, ok := index[entry.ID]; ok {
+					entries[i] = entry
+				} else {
+					index[entry.ID] = len(entries)
+					entries = append(entries, entry)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history file. %v", err)
+		}
+	}
+
+	slices.Reverse(entries)
+
+	return entries, nil
+}
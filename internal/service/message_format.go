@@ -0,0 +1,101 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ExtractTicket returns the first match of pattern in branch, or its first
+// capture group when the pattern has one. It returns an empty string when
+// nothing matches.
+func ExtractTicket(branch, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid ticket pattern. %v", err)
+	}
+
+	match := re.FindStringSubmatch(branch)
+	switch {
+	case match == nil:
+		return "", nil
+	case len(match) > 1 && match[1] != "":
+		return match[1], nil
+	default:
+		return match[0], nil
+	}
+}
+
+// ApplyTicket injects ticket into message: the subject is rewritten with
+// subjectTemplate (a text/template receiving .Ticket and .Subject) and a
+// trailer named trailerKey is appended. Either step is skipped when its
+// setting is empty or the ticket is already there, so applying it twice is
+// harmless.
+func ApplyTicket(message, ticket, subjectTemplate, trailerKey string) (string, error) {
+	if ticket == "" {
+		return message, nil
+	}
+
+	message = strings.TrimSpace(message)
+	subject, body, _ := strings.Cut(message, "\n")
+
+	if subjectTemplate != "" && !strings.Contains(subject, ticket) {
+		tmpl, err := template.New("subject").Parse(subjectTemplate)
+		if err != nil {
+			return "", fmt.Errorf("invalid ticket subject template. %v", err)
+		}
+
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, struct{ Ticket, Subject string }{ticket, subject}); err != nil {
+			return "", fmt.Errorf("invalid ticket subject template. %v", err)
+		}
+		subject = sb.String()
+	}
+
+	message = subject
+	if body != "" {
+		message += "\n" + body
+	}
+
+	if trailerKey == "" {
+		return message, nil
+	}
+
+	return ApplyTrailers(message, []Trailer{{trailerKey, ticket}}, TrailerAddIfDifferent)
+}
+
+// stripTicket undoes the subject rewrite of ApplyTicket, returning subject
+// without what subjectTemplate adds around it for ticket. Subjects that were
+// not rewritten are returned as is.
+func stripTicket(subject, ticket, subjectTemplate string) string {
+	_, stripped, _ := splitTicket(subject, ticket, subjectTemplate)
+	return stripped
+}
+
+// splitTicket splits subject in what subjectTemplate adds before and after it
+// for ticket and the original subject in between. Both additions are empty
+// when the subject was not rewritten.
+func splitTicket(subject, ticket, subjectTemplate string) (string, string, string) {
+	if ticket == "" || subjectTemplate == "" {
+		return "", subject, ""
+	}
+
+	tmpl, err := template.New("subject").Parse(subjectTemplate)
+	if err != nil {
+		return "", subject, ""
+	}
+
+	// The subject is marked with a NUL byte to split what surrounds it
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, struct{ Ticket, Subject string }{ticket, "\x00"}); err != nil {
+		return "", subject, ""
+	}
+	prefix, suffix, ok := strings.Cut(sb.String(), "\x00")
+	if !ok || len(subject) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(subject, prefix) || !strings.HasSuffix(subject, suffix) {
+		return "", subject, ""
+	}
+
+	return prefix, subject[len(prefix) : len(subject)-len(suffix)], suffix
+}
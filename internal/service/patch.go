@@ -0,0 +1,293 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hunkHeader     = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+	similarityLine = regexp.MustCompile(`^(?:dis)?similarity index (\d+)%$`)
+	indexLine      = regexp.MustCompile(`^index ([0-9a-f]+)\.\.([0-9a-f]+)(?: (\d{6}))?$`)
+)
+
+// patchFile is a file section of a patch being parsed.
+type patchFile struct {
+	change   FileChange
+	text     strings.Builder
+	added    strings.Builder
+	hasHunks bool
+	binary   bool
+}
+
+// ParsePatch reads a unified diff, as produced by `git diff`,
+// `git format-patch` or `diff -u`, into the changes it describes. Text around
+// the diff, such as the headers and message of a mailed patch, is ignored.
+// Sizes are unknown, so files left out of the diff are only described by
+// their kind.
+func ParsePatch(r io.Reader) (*StagedChanges, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch. %v", err)
+	}
+
+	var files []*patchFile
+	var current *patchFile
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = &patchFile{}
+			current.change.Status = StatusModified
+			current.change.OldPath, current.change.Path = parseDiffGitPaths(line)
+			files = append(files, current)
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// Plain diffs have no "diff --git" line, a new file starts here
+			if current == nil || current.hasHunks {
+				current = &patchFile{}
+				current.change.Status = StatusModified
+				files = append(files, current)
+			}
+			current.setPaths(line[4:], lines[i+1][4:])
+			current.text.WriteString(line + "\n" + lines[i+1] + "\n")
+			i++
+			continue
+		case current == nil:
+			// Outside of the diff, e.g. the message of a mailed patch
+			continue
+		case line == "-- ":
+			// Signature of a mailed patch, hunk lines are never seen here
+			current = nil
+			continue
+		case strings.HasPrefix(line, "@@ "):
+			match := hunkHeader.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			current.hasHunks = true
+			current.text.WriteString(line + "\n")
+
+			oldCount, newCount := hunkCount(match[1]), hunkCount(match[2])
+			for oldCount > 0 || newCount > 0 {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("patch ends in the middle of a hunk of %s", current.change.Path)
+				}
+				hunkLine := lines[i]
+				switch {
+				case strings.HasPrefix(hunkLine, "\\"):
+					// "\ No newline at end of file" does not count
+				case strings.HasPrefix(hunkLine, "-"):
+					oldCount--
+				case strings.HasPrefix(hunkLine, "+"):
+					newCount--
+					current.added.WriteString(hunkLine[1:] + "\n")
+				default:
+					oldCount--
+					newCount--
+				}
+				current.text.WriteString(hunkLine + "\n")
+			}
+			// A trailing "\ No newline at end of file" belongs to the hunk
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\\") {
+				i++
+				current.text.WriteString(lines[i] + "\n")
+			}
+			continue
+		case current.hasHunks:
+			// Past the hunks of the last file, e.g. a mail signature
+			continue
+		default:
+			current.parseHeader(line)
+		}
+
+		if !current.hasHunks {
+			current.text.WriteString(line + "\n")
+		}
+	}
+
+	changes := &StagedChanges{}
+	var diff strings.Builder
+	excludePatterns := DefaultLockFilePatterns()
+	for _, file := range files {
+		if file.change.Path == "" || matchesAnyPattern(file.change.Path, excludePatterns) {
+			continue
+		}
+		if file.change.Status != StatusRenamed && file.change.Status != StatusCopied {
+			file.change.OldPath = ""
+		}
+
+		if file.binary {
+			file.change.Kind = KindBinary
+		} else if file.change.Status != StatusDeleted {
+			added := []byte(file.added.String())
+			file.change.Kind = classifyFile(file.change.Path, added, int64(len(added)))
+		}
+
+		changes.Files = append(changes.Files, file.change)
+		if file.change.Status != StatusDeleted && !file.change.Summarized() {
+			diff.WriteString(file.text.String())
+		}
+	}
+
+	changes.Diff = diff.String()
+
+	return changes, nil
+}
+
+// parseHeader handles an extended header line of `git diff`.
+func (f *patchFile) parseHeader(line string) {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		f.change.Status = StatusAdded
+		f.change.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		f.change.Status = StatusDeleted
+		f.change.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		f.change.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		f.change.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "rename from "):
+		f.change.Status = StatusRenamed
+		f.change.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		f.change.Path = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		f.change.Status = StatusCopied
+		f.change.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		f.change.Path = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+		f.binary = true
+	default:
+		if match := similarityLine.FindStringSubmatch(line); match != nil {
+			f.change.Similarity, _ = strconv.Atoi(match[1])
+		} else if match := indexLine.FindStringSubmatch(line); match != nil {
+			f.change.OldHash, f.change.NewHash = patchHash(match[1]), patchHash(match[2])
+			// Only modifications have their mode on the index line
+			if match[3] != "" {
+				f.change.OldMode, f.change.NewMode = match[3], match[3]
+			}
+		}
+	}
+}
+
+// setPaths sets the paths of the file from the "---" and "+++" lines.
+func (f *patchFile) setPaths(oldPath, newPath string) {
+	oldPath, newPath = patchPath(oldPath, "a/"), patchPath(newPath, "b/")
+
+	switch {
+	case oldPath == "":
+		f.change.Status = StatusAdded
+		f.change.Path = newPath
+	case newPath == "":
+		f.change.Status = StatusDeleted
+		f.change.Path = oldPath
+	default:
+		f.change.Path = newPath
+	}
+}
+
+// patchHash returns the abbreviated object name of an index line, or an
+// empty string for the missing side of an addition or deletion.
+func patchHash(hash string) string {
+	if strings.Trim(hash, "0") == "" {
+		return ""
+	}
+
+	return hash
+}
+
+// patchPath returns the path of a "---" or "+++" line without its timestamp
+// and prefix, or an empty string for /dev/null.
+func patchPath(file, prefix string) string {
+	if idx := strings.IndexByte(file, '\t'); idx != -1 {
+		file = file[:idx]
+	}
+
+	file = unquotePath(strings.TrimSpace(file))
+	if file == "/dev/null" {
+		return ""
+	}
+
+	return strings.TrimPrefix(file, prefix)
+}
+
+// parseDiffGitPaths extracts both paths of a "diff --git a/x b/y" line. They
+// are only a fallback for headers without "---" and "+++" lines, such as
+// mode changes and binary files.
+func parseDiffGitPaths(line string) (string, string) {
+	line = strings.TrimPrefix(line, "diff --git ")
+
+	if strings.HasPrefix(line, `"`) {
+		if oldPath, rest, ok := cutQuoted(line); ok {
+			return strings.TrimPrefix(oldPath, "a/"), patchPath(rest, "b/")
+		}
+	}
+
+	idx := strings.LastIndex(line, " b/")
+	if idx == -1 {
+		return "", ""
+	}
+
+	return strings.TrimPrefix(line[:idx], "a/"), unquotePath(line[idx+3:])
+}
+
+// cutQuoted splits a C-quoted path from the rest of s.
+func cutQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			path, err := strconv.Unquote(s[:i+1])
+			return path, strings.TrimSpace(s[i+1:]), err == nil
+		}
+	}
+
+	return "", "", false
+}
+
+// unquotePath decodes paths git C-quoted because of special characters.
+func unquotePath(file string) string {
+	if strings.HasPrefix(file, `"`) {
+		if unquoted, err := strconv.Unquote(file); err == nil {
+			return unquoted
+		}
+	}
+
+	return file
+}
+
+// hunkCount parses the line count of a hunk range, 1 when omitted.
+func hunkCount(count string) int {
+	if count == "" {
+		return 1
+	}
+
+	n, _ := strconv.Atoi(count)
+	return n
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
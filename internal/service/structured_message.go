@@ -0,0 +1,252 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// breakingChangeKey is the Conventional Commits footer token of breaking
+// changes.
+const breakingChangeKey = "BREAKING CHANGE"
+
+// listMarker matches the marker of a list item, e.g. "- ", "* " or "1. ".
+var listMarker = regexp.MustCompile(`^([-*•]|[0-9]+[.)]) `)
+
+// StructuredMessage is a commit message as returned by the model, split in
+// fields so that its layout is decided here rather than by the model.
+type StructuredMessage struct {
+	// Type is the commit type, or the gitmoji, empty for conventions
+	// without one.
+	Type    string `json:"type"`
+	Scope   string `json:"scope"`
+	Subject string `json:"subject"`
+	// Body holds the bullet points, or paragraphs, of the body.
+	Body []string `json:"body"`
+	// BreakingChange describes what breaks, empty when nothing does.
+	BreakingChange string    `json:"breaking_change"`
+	Footers        []Trailer `json:"footers"`
+	// FreeFormBody lays the body items out as paragraphs keeping their line
+	// breaks, for messages following a commit template, instead of the body
+	// layout of the convention.
+	FreeFormBody bool `json:"-"`
+}
+
+// responseSchema is the JSON schema of StructuredMessage requested from the
+// model.
+func responseSchema(convention *Convention) *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"type":    {Type: genai.TypeString, Description: convention.TypeHint},
+			"scope":   {Type: genai.TypeString, Description: convention.ScopeHint},
+			"subject": {Type: genai.TypeString, Description: convention.SubjectFormat},
+			"body": {
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{Type: genai.TypeString},
+			},
+			"breaking_change": {
+				Type:        genai.TypeString,
+				Description: "what breaks backward compatibility and how to migrate, empty when nothing does",
+			},
+			"footers": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"key":   {Type: genai.TypeString},
+						"value": {Type: genai.TypeString},
+					},
+					Required: []string{"key", "value"},
+				},
+			},
+		},
+		Required: []string{"type", "scope", "subject", "body", "breaking_change", "footers"},
+	}
+}
+
+// ParseStructuredMessage decodes a response of the model. Code fences some
+// models wrap JSON in are ignored.
+func ParseStructuredMessage(response string) (*StructuredMessage, error) {
+	response = stripCodeFence(response)
+
+	var msg StructuredMessage
+	if err := json.Unmarshal([]byte(response), &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse structured response. %v", err)
+	}
+	if strings.TrimSpace(msg.Subject) == "" {
+		return nil, fmt.Errorf("structured response has no subject")
+	}
+
+	return &msg, nil
+}
+
+// stripCodeFence removes a markdown code fence around text, if any.
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+
+	// Drop the opening fence along with its info string, e.g. "```json"
+	if idx := strings.IndexByte(text, '\n'); idx != -1 {
+		text = text[idx+1:]
+	} else {
+		text = strings.TrimPrefix(text, "```")
+	}
+
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+// Assemble renders msg as a commit message following the convention: the
+// subject line, the body wrapped at BodyWidth, then the breaking change and
+// the other footers as trailers.
+func (c *Convention) Assemble(msg *StructuredMessage) string {
+	msg = msg.normalize()
+
+	subject := msg.Subject
+	// Some models repeat the prefix in the subject despite the schema, and a
+	// prefix without its type would be malformed, so the subject is then
+	// kept as is
+	if c.formatSubject != nil && (c.SubjectPattern == nil || !c.SubjectPattern.MatchString(subject)) &&
+		(msg.Type != "" || !c.HasType()) {
+		subject = c.formatSubject(msg)
+	}
+
+	paragraphs := []string{subject}
+	if len(msg.Body) > 0 && msg.FreeFormBody {
+		for _, item := range msg.Body {
+			paragraphs = append(paragraphs, wrapLines(item, c.BodyWidth))
+		}
+	} else if len(msg.Body) > 0 {
+		var body []string
+		for _, item := range msg.Body {
+			if c.ProseBody {
+				body = append(body, wrapText(item, c.BodyWidth, "", ""))
+			} else {
+				body = append(body, wrapText(item, c.BodyWidth, "- ", "  "))
+			}
+		}
+		if c.ProseBody {
+			paragraphs = append(paragraphs, strings.Join(body, "\n\n"))
+		} else {
+			paragraphs = append(paragraphs, strings.Join(body, "\n"))
+		}
+	}
+
+	var footers []string
+	if msg.BreakingChange != "" {
+		footers = append(footers, Trailer{breakingChangeKey, msg.BreakingChange}.String())
+	}
+	for _, footer := range msg.Footers {
+		footers = append(footers, footer.String())
+	}
+	if len(footers) > 0 {
+		paragraphs = append(paragraphs, strings.Join(footers, "\n"))
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// normalize returns a copy of msg with blank fields dropped and whitespace,
+// as well as list markers the model may add to body items, trimmed.
+func (msg *StructuredMessage) normalize() *StructuredMessage {
+	normalized := &StructuredMessage{
+		Type:           strings.TrimSpace(msg.Type),
+		Scope:          strings.TrimSpace(msg.Scope),
+		Subject:        strings.TrimSpace(msg.Subject),
+		BreakingChange: strings.Join(strings.Fields(msg.BreakingChange), " "),
+		FreeFormBody:   msg.FreeFormBody,
+	}
+
+	for _, item := range msg.Body {
+		if msg.FreeFormBody {
+			if item = trimLines(item); item != "" {
+				normalized.Body = append(normalized.Body, item)
+			}
+			continue
+		}
+
+		item = strings.TrimSpace(item)
+		item = strings.TrimSpace(strings.TrimPrefix(item, listMarker.FindString(item)))
+		if item != "" {
+			normalized.Body = append(normalized.Body, item)
+		}
+	}
+
+	for _, footer := range msg.Footers {
+		footer.Key, footer.Value = strings.TrimSpace(footer.Key), strings.TrimSpace(footer.Value)
+		if footer.Key == "" || footer.Value == "" {
+			continue
+		}
+		// The breaking change has its own field
+		if strings.EqualFold(footer.Key, breakingChangeKey) || strings.EqualFold(footer.Key, "BREAKING-CHANGE") {
+			if normalized.BreakingChange == "" {
+				normalized.BreakingChange = footer.Value
+			}
+			continue
+		}
+		normalized.Footers = append(normalized.Footers, footer)
+	}
+
+	return normalized
+}
+
+// trimLines removes trailing whitespace from the lines of text, along with
+// its leading and trailing blank lines.
+func trimLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// wrapLines wraps each line of text longer than width columns on its own,
+// so that the line breaks of text are kept. Continuation lines are indented
+// like the line they wrap, past its list marker if any.
+func wrapLines(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if utf8.RuneCountInString(line) <= width {
+			continue
+		}
+
+		content := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(content)]
+		continuation := indent
+		if listMarker.MatchString(content) {
+			continuation += strings.Repeat(" ", utf8.RuneCountInString(listMarker.FindString(content)))
+		}
+		lines[i] = wrapText(content, width, indent, continuation)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// wrapText wraps text at width columns. The first line starts with
+// firstIndent and the following ones with indent. Words longer than the
+// width, such as URLs, are never broken.
+func wrapText(text string, width int, firstIndent, indent string) string {
+	var lines []string
+	line := firstIndent
+	lineEmpty := true
+	for _, word := range strings.Fields(text) {
+		if !lineEmpty && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line)
+			line, lineEmpty = indent, true
+		}
+		if !lineEmpty {
+			line += " "
+		}
+		line += word
+		lineEmpty = false
+	}
+
+	return strings.Join(append(lines, line), "\n")
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Trailer is a "Key: value" line of the trailer block at the end of a commit
+// message, e.g. "Co-authored-by: Jane Doe <jane@example.com>".
+type Trailer struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (t Trailer) String() string {
+	return fmt.Sprintf("%s: %s", t.Key, t.Value)
+}
+
+// ParseTrailer parses a "Key: value" (or "Key=value") string.
+func ParseTrailer(s string) (Trailer, error) {
+	idx := strings.IndexAny(s, ":=")
+	if idx <= 0 {
+		return Trailer{}, fmt.Errorf("invalid trailer %q. expected \"Key: value\"", s)
+	}
+
+	key := strings.TrimSpace(s[:idx])
+	if !trailerKey.MatchString(key) {
+		return Trailer{}, fmt.Errorf("invalid trailer key %q", key)
+	}
+
+	return Trailer{key, strings.TrimSpace(s[idx+1:])}, nil
+}
+
+// Values of the ifExists argument of ApplyTrailers, named after the
+// trailer.ifExists options of `git interpret-trailers`.
+const (
+	// TrailerAddIfDifferentNeighbor adds the trailer unless the trailer it
+	// would follow has the same key and value. It is git's default.
+	TrailerAddIfDifferentNeighbor = "addIfDifferentNeighbor"
+	// TrailerAddIfDifferent adds the trailer unless any trailer has the same
+	// key and value.
+	TrailerAddIfDifferent = "addIfDifferent"
+	// TrailerAdd always adds the trailer.
+	TrailerAdd = "add"
+	// TrailerReplace removes existing trailers with the same key first.
+	TrailerReplace = "replace"
+	// TrailerDoNothing leaves the message alone if the key already exists.
+	TrailerDoNothing = "doNothing"
+)
+
+var (
+	trailerKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+	// "BREAKING CHANGE" is the only key with a space, from Conventional Commits
+	trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*|BREAKING CHANGE): `)
+)
+
+// ApplyTrailers adds trailers to the trailer block of message following the
+// semantics of `git interpret-trailers --if-exists <ifExists>`: the block is
+// the last paragraph when it only holds trailers, otherwise a new one is
+// started after a blank line. Keys are compared case-insensitively.
+func ApplyTrailers(message string, trailers []Trailer, ifExists string) (string, error) {
+	text, block := splitTrailers(message)
+
+	for _, trailer := range trailers {
+		var existing []int
+		for i, line := range block {
+			if key, _, _ := strings.Cut(line, ": "); strings.EqualFold(key, trailer.Key) {
+				existing = append(existing, i)
+			}
+		}
+		sameValue := func(i int) bool {
+			_, value, _ := strings.Cut(block[i], ": ")
+			return strings.TrimSpace(value) == trailer.Value
+		}
+
+		switch ifExists {
+		case "", TrailerAddIfDifferentNeighbor:
+			// Trailers are added at the end, so the neighbor is the last one
+			if last := len(block) - 1; len(existing) > 0 && existing[len(existing)-1] == last &&
+				sameValue(last) {
+				continue
+			}
+		case TrailerAddIfDifferent:
+			if slices.ContainsFunc(existing, sameValue) {
+				continue
+			}
+		case TrailerAdd:
+		case TrailerReplace:
+			for i := len(existing) - 1; i >= 0; i-- {
+				block = append(block[:existing[i]], block[existing[i]+1:]...)
+			}
+		case TrailerDoNothing:
+			if len(existing) > 0 {
+				continue
+			}
+		default:
+			return "", fmt.Errorf(
+				"invalid trailers.if_exists value %q. expected one of %s, %s, %s, %s or %s",
+				ifExists,
+				TrailerAddIfDifferentNeighbor,
+				TrailerAddIfDifferent,
+				TrailerAdd,
+				TrailerReplace,
+				TrailerDoNothing,
+			)
+		}
+
+		block = append(block, trailer.String())
+	}
+
+	if len(block) == 0 {
+		return text, nil
+	}
+
+	return text + "\n\n" + strings.Join(block, "\n"), nil
+}
+
+// splitTrailers splits message into its text and its trailer block, the last
+// paragraph when every line of it is a trailer or a continuation line. The
+// subject line alone is never treated as a trailer block.
+func splitTrailers(message string) (string, []string) {
+	message = strings.TrimRight(message, "\n")
+
+	idx := strings.LastIndex(message, "\n\n")
+	if idx == -1 {
+		return message, nil
+	}
+
+	var block []string
+	for _, line := range strings.Split(message[idx+2:], "\n") {
+		switch {
+		case trailerLine.MatchString(line):
+			block = append(block, line)
+		case len(block) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			// Folded value, kept together with its trailer
+			block[len(block)-1] += "\n" + line
+		default:
+			return message, nil
+		}
+	}
+
+	return message[:idx], block
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnstagedFile is a working tree change that is not staged yet.
+type UnstagedFile struct {
+	Path string
+	// Status is StatusModified, StatusDeleted, or StatusAdded for untracked
+	// files.
+	Status ChangeStatus
+	Binary bool
+	// Hunks are the changes of a modified text file, which can be staged
+	// separately.
+	Hunks []Hunk
+}
+
+// Hunk is a "@@" section of a unified diff.
+type Hunk struct {
+	Header string
+	// Lines are the context, removed and added lines of the hunk, with their
+	// " ", "-" or "+" prefix.
+	Lines []string
+}
+
+func (h Hunk) String() string {
+	return h.Header + "\n" + strings.Join(h.Lines, "\n") + "\n"
+}
+
+// parseUnstagedDiff parses the output of `git diff` between the index and the
+// working tree, without renames, into the files it changes.
+func parseUnstagedDiff(diff string) ([]UnstagedFile, error) {
+	var files []UnstagedFile
+	var current *UnstagedFile
+
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, UnstagedFile{Status: StatusModified})
+			current = &files[len(files)-1]
+			_, current.Path = parseDiffGitPaths(line)
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "deleted file mode "):
+			current.Status = StatusDeleted
+		case strings.HasPrefix(line, "Binary files "):
+			current.Binary = true
+		case strings.HasPrefix(line, "+++ "):
+			if path := patchPath(line[4:], "b/"); path != "" {
+				current.Path = path
+			}
+		case strings.HasPrefix(line, "@@ "):
+			match := hunkRanges.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+
+			hunk := Hunk{Header: line}
+			oldCount, newCount := hunkCount(match[2]), hunkCount(match[4])
+			for oldCount > 0 || newCount > 0 {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("diff ends in the middle of a hunk of %s", current.Path)
+				}
+				switch hunkLine := lines[i]; {
+				case strings.HasPrefix(hunkLine, "\\"):
+				case strings.HasPrefix(hunkLine, "-"):
+					oldCount--
+				case strings.HasPrefix(hunkLine, "+"):
+					newCount--
+				default:
+					oldCount--
+					newCount--
+				}
+				hunk.Lines = append(hunk.Lines, lines[i])
+			}
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\\") {
+				i++
+				hunk.Lines = append(hunk.Lines, lines[i])
+			}
+			current.Hunks = append(current.Hunks, hunk)
+		}
+	}
+
+	// Deletions are staged as a whole
+	for i := range files {
+		if files[i].Status == StatusDeleted {
+			files[i].Hunks = nil
+		}
+	}
+
+	return files, nil
+}
+
+// applyHunks applies hunks, computed against content and sorted by position,
+// to content.
+func applyHunks(content string, hunks []Hunk) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var result strings.Builder
+	pos := 0
+	for _, hunk := range hunks {
+		match := hunkRanges.FindStringSubmatch(hunk.Header)
+		if match == nil {
+			return "", fmt.Errorf("invalid hunk header %q", hunk.Header)
+		}
+
+		// An empty old range starts after the given line
+		start := atoi(match[1]) - 1
+		if hunkCount(match[2]) == 0 {
+			start++
+		}
+		if start < pos || start > len(lines) {
+			return "", fmt.Errorf("hunk %q does not apply", hunk.Header)
+		}
+		for _, line := range lines[pos:start] {
+			result.WriteString(line)
+		}
+		pos = start
+
+		// added tells whether the last line written comes from the hunk
+		var added bool
+		for _, hunkLine := range hunk.Lines {
+			switch {
+			case strings.HasPrefix(hunkLine, "\\"):
+				// "\ No newline at end of file" applies to the line before
+				if added {
+					trimmed := strings.TrimSuffix(result.String(), "\n")
+					result.Reset()
+					result.WriteString(trimmed)
+				}
+			case strings.HasPrefix(hunkLine, "+"):
+				result.WriteString(hunkLine[1:] + "\n")
+				added = true
+			default:
+				if pos >= len(lines) || strings.TrimSuffix(lines[pos], "\n") != hunkLine[min(1, len(hunkLine)):] {
+					return "", fmt.Errorf("hunk %q does not apply", hunk.Header)
+				}
+				if strings.HasPrefix(hunkLine, "-") {
+					added = false
+				} else {
+					result.WriteString(lines[pos])
+					added = true
+				}
+				pos++
+			}
+		}
+	}
+
+	for _, line := range lines[pos:] {
+		result.WriteString(line)
+	}
+
+	return result.String(), nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import "testing"
+
+func TestApplyHunks(t *testing.T) {
+	hunk := func(header string, lines ...string) Hunk {
+		return Hunk{Header: header, Lines: lines}
+	}
+	numbers := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	firstHunk := hunk("@@ -1,5 +1,5 @@", " 1", "-2", "+two", " 3", " 4", " 5")
+	secondHunk := hunk("@@ -6,5 +6,5 @@", " 6", " 7", " 8", "-9", "+nine", " 10")
+
+	tests := []struct {
+		name    string
+		content string
+		hunks   []Hunk
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "all hunks",
+			content: numbers,
+			hunks:   []Hunk{firstHunk, secondHunk},
+			want:    "1\ntwo\n3\n4\n5\n6\n7\n8\nnine\n10\n",
+		},
+		{
+			name:    "earlier hunk left unselected",
+			content: numbers,
+			hunks:   []Hunk{secondHunk},
+			want:    "1\n2\n3\n4\n5\n6\n7\n8\nnine\n10\n",
+		},
+		{
+			name:    "later hunk left unselected",
+			content: numbers,
+			hunks:   []Hunk{firstHunk},
+			want:    "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		},
+		{
+			name:    "insertion only",
+			content: "a\nb\nc\n",
+			hunks:   []Hunk{hunk("@@ -2,0 +3,2 @@", "+x", "+y")},
+			want:    "a\nb\nx\ny\nc\n",
+		},
+		{
+			name:    "insertion only at the start",
+			content: "a\nb\n",
+			hunks:   []Hunk{hunk("@@ -0,0 +1 @@", "+x")},
+			want:    "x\na\nb\n",
+		},
+		{
+			name:    "insertion into an empty file",
+			content: "",
+			hunks:   []Hunk{hunk("@@ -0,0 +1,2 @@", "+x", "+y")},
+			want:    "x\ny\n",
+		},
+		{
+			name:    "no newline at end of old file",
+			content: "a\nb",
+			hunks: []Hunk{hunk(
+				"@@ -1,2 +1,2 @@", " a", "-b", `\ No newline at end of file`, "+b",
+			)},
+			want: "a\nb\n",
+		},
+		{
+			name:    "no newline at end of new file",
+			content: "a\nb\n",
+			hunks: []Hunk{hunk(
+				"@@ -1,2 +1,2 @@", " a", "-b", "+b", `\ No newline at end of file`,
+			)},
+			want: "a\nb",
+		},
+		{
+			name:    "no newline at end of either file",
+			content: "a\nb",
+			hunks: []Hunk{hunk(
+				"@@ -1,2 +1,2 @@",
+				" a",
+				"-b",
+				`\ No newline at end of file`,
+				"+c",
+				`\ No newline at end of file`,
+			)},
+			want: "a\nc",
+		},
+		{
+			name:    "unchanged last line without newline",
+			content: "a\nb",
+			hunks: []Hunk{hunk(
+				"@@ -1,2 +1,2 @@", "-a", "+x", " b", `\ No newline at end of file`,
+			)},
+			want: "x\nb",
+		},
+		{
+			name:    "context mismatch",
+			content: "a\nb\n",
+			hunks:   []Hunk{hunk("@@ -1,2 +1,2 @@", " a", "-c", "+d")},
+			wantErr: true,
+		},
+		{
+			name:    "overlapping hunks",
+			content: numbers,
+			hunks:   []Hunk{secondHunk, firstHunk},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyHunks(tt.content, tt.hunks)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyHunks() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyHunks() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("applyHunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TokenUsage is the number of tokens a generation was billed for.
+type TokenUsage struct {
+	PromptTokens   int `json:"prompt_tokens"`
+	ResponseTokens int `json:"response_tokens"`
+}
+
+// Total returns the number of prompt and response tokens.
+func (u TokenUsage) Total() int {
+	return u.PromptTokens + u.ResponseTokens
+}
+
+// PatchUsageRepo is the Repo of the usage of messages generated from a patch
+// by `generate`, which does not need a repository.
+const PatchUsageRepo = "(patch)"
+
+// UsageRecord is the token usage of a single generation.
+type UsageRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Repo      string    `json:"repo"`
+	Model     string    `json:"model"`
+	TokenUsage
+}
+
+// ModelPricing is the price of a model per million tokens, as configured by
+// the `pricing` list.
+type ModelPricing struct {
+	Model  string  `mapstructure:"model"`
+	Input  float64 `mapstructure:"input"`
+	Output float64 `mapstructure:"output"`
+}
+
+// Cost returns the price of usage.
+func (p ModelPricing) Cost(usage TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*p.Input + float64(usage.ResponseTokens)*p.Output) / 1e6
+}
+
+// Pricing returns the configured model prices by model name.
+func Pricing() (map[string]ModelPricing, error) {
+	var prices []ModelPricing
+	if err := viper.UnmarshalKey("pricing", &prices); err != nil {
+		return nil, fmt.Errorf("invalid pricing config. %v", err)
+	}
+
+	pricing := make(map[string]ModelPricing, len(prices))
+	for _, price := range prices {
+		pricing[price.Model] = price
+	}
+
+	return pricing, nil
+}
+
+// UsageService stores the token usage of every generation in a JSONL file.
+type UsageService struct {
+	path string
+}
+
+func NewUsageService(path string) *UsageService {
+	return &UsageService{path}
+}
+
+// DefaultUsagePath returns the usage file in the geminicommit config
+// directory.
+func DefaultUsagePath() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(config, "geminicommit", "usage.jsonl"), nil
+}
+
+// Record appends record to the usage file.
+func (u *UsageService) Record(record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage record. %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(u.path), 0o755); err != nil {
+		return fmt.Errorf("failed to make usage dir. %v", err)
+	}
+
+	file, err := os.OpenFile(u.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage file. %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage file. %v", err)
+	}
+
+	return nil
+}
+
+// Records returns the usage records made since the given time, oldest first.
+func (u *UsageService) Records(since time.Time) ([]UsageRecord, error) {
+	file, err := os.Open(u.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage file. %v", err)
+	}
+	defer file.Close()
+
+	var records []UsageRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record UsageRecord
+			// A line cut short by a crash is skipped
+			if json.Unmarshal(line, &record) == nil && !record.Timestamp.Before(since) {
+				records = append(records, record)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read usage file. %v", err)
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+var diffHeaderStyle = lipgloss.NewStyle().Bold(true)
+
+// diffFile is a file of the diff tab of the review screen.
+type diffFile struct {
+	path string
+	// content is the highlighted diff of the file, or a note when its
+	// content was not sent to the model.
+	content string
+}
+
+// newDiffFiles splits the staged diff per file and highlights it. Deleted
+// files and files left out of the diff get a note instead, so every staged
+// file can be checked against the message.
+func newDiffFiles(changes *service.StagedChanges) []diffFile {
+	diffs := changes.FileDiffs()
+
+	var files []diffFile
+	for _, file := range changes.Files {
+		var content string
+		switch {
+		case file.Status == service.StatusDeleted:
+			content = removedLineStyle.Render("Deleted file.")
+		case file.Summarized():
+			content = lipgloss.NewStyle().Italic(true).Render(
+				"Left out of the diff sent to the model: " + string(file.Kind) + ".",
+			)
+		case diffs[file.Path] == "":
+			content = lipgloss.NewStyle().Italic(true).Render("No content changes.")
+		default:
+			content = highlightDiff(file.Path, diffs[file.Path])
+		}
+		files = append(files, diffFile{file.Path, content})
+	}
+
+	return files
+}
+
+// highlightDiff colors the diff of a file: headers, hunk ranges, the +/-
+// markers and the code itself, highlighted for the language of path. Lines
+// are highlighted one by one, since hunks hold both sides of the file and
+// rarely start at the beginning of a construct.
+func highlightDiff(path, diff string) string {
+	lexer := lexers.Match(path)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	style := styles.Get("monokai")
+	if !lipgloss.HasDarkBackground() {
+		style = styles.Get("monokailight")
+	}
+	formatter := formatters.Get("terminal256")
+
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	highlighted := make([]string, 0, len(lines))
+	inHunk := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			highlighted = append(highlighted, hunkHeaderStyle.Render(line))
+			continue
+		case !inHunk || line == "" || strings.HasPrefix(line, "\\"):
+			highlighted = append(highlighted, diffHeaderStyle.Render(line))
+			continue
+		}
+
+		marker, code := line[:1], line[1:]
+		switch marker {
+		case "+":
+			marker = addedLineStyle.Render(marker)
+		case "-":
+			marker = removedLineStyle.Render(marker)
+		}
+
+		iterator, err := lexer.Tokenise(nil, code)
+		if err != nil {
+			highlighted = append(highlighted, marker+code)
+			continue
+		}
+
+		// The lexer ends the line with a newline, which may be part of the
+		// last token, e.g. of a comment
+		tokens := iterator.Tokens()
+		for i := range tokens {
+			tokens[i].Value = strings.TrimSuffix(tokens[i].Value, "\n")
+		}
+
+		var buf bytes.Buffer
+		if err := formatter.Format(&buf, style, chroma.Literator(tokens...)); err != nil {
+			highlighted = append(highlighted, marker+code)
+			continue
+		}
+		highlighted = append(highlighted, marker+buf.String())
+	}
+
+	return strings.Join(highlighted, "\n")
+}
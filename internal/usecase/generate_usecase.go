@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+type GenerateUsecase struct {
+	geminiService *service.GeminiService
+	usageService  *service.UsageService
+}
+
+func NewGenerateUsecase(
+	geminiService *service.GeminiService,
+	usageService *service.UsageService,
+) *GenerateUsecase {
+	return &GenerateUsecase{geminiService, usageService}
+}
+
+// GenerateCommand prints a commit message for the unified diff read from
+// patchPath ("-" for stdin), without needing a repository. Only the message
+// goes to stdout, everything else is printed to stderr.
+func (g *GenerateUsecase) GenerateCommand(patchPath string, promptAddition *string) error {
+	color.Output = os.Stderr
+
+	var patch io.Reader = os.Stdin
+	if patchPath != "-" {
+		file, err := os.Open(patchPath)
+		if err != nil {
+			return fmt.Errorf("failed to open patch. %v", err)
+		}
+		defer file.Close()
+		patch = file
+	}
+
+	changes, err := service.ParsePatch(patch)
+	if err != nil {
+		return err
+	}
+
+	if len(changes.Files) == 0 {
+		return fmt.Errorf("no changes found in the patch")
+	}
+
+	color.New(color.Underline).Printf("Detected %d changed files:\n", len(changes.Files))
+	printStagedFiles(changes)
+	breaking := service.DetectBreakingChanges(changes, nil)
+	printBreakingChanges(breaking)
+
+	convention, err := service.ConventionByName(viper.GetString("message.convention"))
+	if err != nil {
+		return err
+	}
+
+	detail, err := resolveDetailLevel(changes)
+	if err != nil {
+		return err
+	}
+
+	color.New(color.FgMagenta).Print("The AI is analyzing the patch...")
+	result, err := g.geminiService.AnalyzeChanges(
+		context.Background(),
+		changes,
+		service.AnalyzeOptions{
+			PromptAddition:  promptAddition,
+			Detail:          detail,
+			BreakingChanges: breaking,
+			OnRetry:         printRetry,
+			OnFallback:      printFallback,
+		},
+	)
+	if err != nil {
+		color.New(color.FgRed).Println(" ✗")
+		return err
+	}
+	color.New(color.FgGreen).Println(" ✓")
+
+	printAnalyzeResult(result)
+	if result.Usage != nil {
+		recordUsage(g.usageService, service.PatchUsageRepo, result)
+	}
+
+	for _, warning := range convention.Lint(result.Message, "", "") {
+		color.New(color.FgYellow).Printf("⚠ %s\n", warning)
+	}
+
+	fmt.Println(result.Message)
+
+	return nil
+}
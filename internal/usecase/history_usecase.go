@@ -0,0 +1,221 @@
+package usecase
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/fatih/color"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+type historyAction string
+
+const (
+	historyCommit historyAction = "COMMIT"
+	historyPrint  historyAction = "PRINT"
+	historyCancel historyAction = "CANCEL"
+)
+
+type HistoryUsecase struct {
+	gitService     service.GitService
+	historyService *service.HistoryService
+}
+
+func NewHistoryUsecase(
+	gitService service.GitService,
+	historyService *service.HistoryService,
+) *HistoryUsecase {
+	return &HistoryUsecase{gitService, historyService}
+}
+
+// HistoryCommand lets the user browse the latest generation sessions of the
+// current repository (of every repository with allRepos, or outside of one)
+// and reuse one of their messages.
+func (h *HistoryUsecase) HistoryCommand(limit int, allRepos bool) error {
+	entries, err := h.historyService.Entries()
+	if err != nil {
+		return err
+	}
+
+	if !allRepos {
+		if repo, err := h.gitService.RepositoryRoot(); err == nil {
+			entries = filterEntries(entries, func(entry service.HistoryEntry) bool {
+				return entry.Repo == repo
+			})
+		}
+	}
+
+	// Sessions interrupted before the first message have nothing to reuse
+	entries = filterEntries(entries, func(entry service.HistoryEntry) bool {
+		return entry.FinalMessage != ""
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	if len(entries) == 0 {
+		color.New(color.FgYellow).Println("No commit messages in the history yet.")
+		return nil
+	}
+
+	options := make([]huh.Option[int], 0, len(entries))
+	for i, entry := range entries {
+		options = append(options, huh.NewOption(describeHistoryEntry(entry), i))
+	}
+
+	var selected int
+	if err := huh.NewSelect[int]().
+		Title("Select a generation").
+		Options(options...).
+		Value(&selected).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return err
+	}
+
+	message, err := pickHistoryMessage(entries[selected])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n\n", message)
+
+	var selectedAction historyAction
+	if err := huh.NewSelect[historyAction]().
+		Title("Use this message?").
+		Options(
+			huh.NewOption("Commit staged changes with it", historyCommit),
+			huh.NewOption("Print it", historyPrint),
+			huh.NewOption("Cancel", historyCancel),
+		).
+		Value(&selectedAction).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return err
+	}
+
+	switch selectedAction {
+	case historyCommit:
+		if err := h.gitService.VerifyGitRepository(); err != nil {
+			return err
+		}
+		confirmed, err := h.confirmStagedChanges(entries[selected])
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			color.New(color.Italic).Println("Commit cancelled.")
+			return nil
+		}
+		if err := h.gitService.CommitChanges(message); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Println("✔ Successfully committed!")
+	case historyPrint:
+		fmt.Println(message)
+	}
+
+	return nil
+}
+
+// confirmStagedChanges tells whether the staged changes are the ones the
+// message of entry was generated for, asking the user when they are not.
+func (h *HistoryUsecase) confirmStagedChanges(entry service.HistoryEntry) (bool, error) {
+	changes, err := h.gitService.DetectDiffChanges()
+	if err == nil && changes.Hash() == entry.DiffHash {
+		return true, nil
+	}
+
+	title := "The staged changes differ from the ones this message was generated for. Commit anyway?"
+	if err != nil {
+		title = fmt.Sprintf("Failed to read the staged changes (%v). Commit anyway?", err)
+	}
+
+	var confirmed bool
+	if err := huh.NewConfirm().
+		Title(title).
+		Affirmative("Yes").
+		Negative("No").
+		Value(&confirmed).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return false, err
+	}
+
+	return confirmed, nil
+}
+
+// pickHistoryMessage lets the user choose among the messages of entry, the
+// final one first, and skips the prompt when there is only one.
+func pickHistoryMessage(entry service.HistoryEntry) (string, error) {
+	messages := []string{entry.FinalMessage}
+	labels := []string{"Final message"}
+	for i, candidate := range entry.Candidates {
+		if candidate == entry.FinalMessage {
+			continue
+		}
+		messages = append(messages, candidate)
+		labels = append(labels, fmt.Sprintf("Candidate %d: %s", i+1, subjectOf(candidate)))
+	}
+
+	if len(messages) == 1 {
+		return messages[0], nil
+	}
+
+	options := make([]huh.Option[int], 0, len(messages))
+	for i, label := range labels {
+		options = append(options, huh.NewOption(label, i))
+	}
+
+	var selected int
+	if err := huh.NewSelect[int]().
+		Title("Select a message").
+		Options(options...).
+		Value(&selected).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return "", err
+	}
+
+	return messages[selected], nil
+}
+
+// describeHistoryEntry renders entry as a single line, e.g.
+// "2024-05-01 14:02  geminicommit (main)  feat: add history  [committed]".
+func describeHistoryEntry(entry service.HistoryEntry) string {
+	repo := filepath.Base(entry.Repo)
+	if entry.Branch != "" {
+		repo += fmt.Sprintf(" (%s)", entry.Branch)
+	}
+
+	return fmt.Sprintf(
+		"%s  %s  %s  [%s]",
+		entry.Timestamp.Local().Format("2006-01-02 15:04"),
+		repo,
+		subjectOf(entry.FinalMessage),
+		entry.Outcome,
+	)
+}
+
+func subjectOf(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return subject
+}
+
+func filterEntries(
+	entries []service.HistoryEntry,
+	keep func(service.HistoryEntry) bool,
+) []service.HistoryEntry {
+	var kept []service.HistoryEntry
+	for _, entry := range entries {
+		if keep(entry) {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/fatih/color"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+// Values of the `--output` flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// commitReport is the document printed by `--output json`.
+type commitReport struct {
+	StagedFiles     []reportFile               `json:"staged_files"`
+	DeletedFiles    []string                   `json:"deleted_files"`
+	ExcludedFiles   []reportExcludedFile       `json:"excluded_files"`
+	BreakingChanges []string                   `json:"breaking_changes"`
+	Model           string                     `json:"model,omitempty"`
+	Usage           *service.TokenUsage        `json:"usage,omitempty"`
+	Cached          bool                       `json:"cached"`
+	Candidates      []string                   `json:"candidates"`
+	Fields          *service.StructuredMessage `json:"fields,omitempty"`
+	Warnings        []string                   `json:"warnings,omitempty"`
+	Message         string                     `json:"message,omitempty"`
+	Commit          string                     `json:"commit,omitempty"`
+	Error           string                     `json:"error,omitempty"`
+}
+
+type reportFile struct {
+	Status     service.ChangeStatus `json:"status"`
+	Path       string               `json:"path"`
+	OldPath    string               `json:"old_path,omitempty"`
+	Similarity int                  `json:"similarity,omitempty"`
+	OldMode    string               `json:"old_mode,omitempty"`
+	NewMode    string               `json:"new_mode,omitempty"`
+}
+
+// reportExcludedFile is a file left out of the diff sent to the model, lock
+// files included.
+type reportExcludedFile struct {
+	Path    string           `json:"path"`
+	Kind    service.FileKind `json:"kind"`
+	OldSize int64            `json:"old_size"`
+	NewSize int64            `json:"new_size"`
+}
+
+func newCommitReport() *commitReport {
+	return &commitReport{
+		StagedFiles:     []reportFile{},
+		DeletedFiles:    []string{},
+		ExcludedFiles:   []reportExcludedFile{},
+		BreakingChanges: []string{},
+		Candidates:      []string{},
+	}
+}
+
+func (c *commitReport) addChanges(changes *service.StagedChanges) {
+	for _, file := range append(slices.Clone(changes.Files), changes.LockFiles...) {
+		if file.Status == service.StatusDeleted {
+			c.DeletedFiles = append(c.DeletedFiles, file.Path)
+			continue
+		}
+
+		c.StagedFiles = append(c.StagedFiles, reportFile{
+			Status:     file.Status,
+			Path:       file.Path,
+			OldPath:    file.OldPath,
+			Similarity: file.Similarity,
+			OldMode:    file.OldMode,
+			NewMode:    file.NewMode,
+		})
+		if file.Summarized() {
+			c.ExcludedFiles = append(c.ExcludedFiles, reportExcludedFile{
+				Path:    file.Path,
+				Kind:    file.Kind,
+				OldSize: file.OldSize,
+				NewSize: file.NewSize,
+			})
+		}
+	}
+}
+
+func (c *commitReport) addBreakingChanges(breaking []service.BreakingChange) {
+	for _, change := range breaking {
+		c.BreakingChanges = append(c.BreakingChanges, change.String())
+	}
+}
+
+// redirectOutput sends everything printed to stdout, including the output of
+// git and hooks, to stderr instead so that stdout only holds the report. The
+// returned function restores stdout and writes the report to it.
+func redirectOutput(report *commitReport) func() error {
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = os.Stderr, os.Stderr
+
+	return func() error {
+		os.Stdout, color.Output = stdout, colorOutput
+		return writeReport(stdout, report)
+	}
+}
+
+func writeReport(w io.Writer, report *commitReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to write JSON output. %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+// editorResult is how the user left the message editor.
+type editorResult int
+
+const (
+	editorCancelled editorResult = iota
+	editorSaved
+	// editorExternal asks to keep editing in the configured editor.
+	editorExternal
+)
+
+// messageEditorModel edits the commit message in place, with a ruler marking
+// the subject length limit and the body width of the convention.
+type messageEditorModel struct {
+	textarea   textarea.Model
+	convention *service.Convention
+	result     editorResult
+	err        string
+	ready      bool
+}
+
+var (
+	editorTitleStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#F780E2")).Bold(true).Padding(0, 0, 1, 0)
+	editorRulerStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#555"))
+	editorLimitStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#E5C07B"))
+	editorWidthStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#61AFEF"))
+	editorErrorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+	editorOkStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+	editorStatusStyle = lipgloss.NewStyle().Padding(1, 0, 0, 0)
+	editorHintStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#666")).Italic(true)
+)
+
+func newMessageEditorModel(message string, convention *service.Convention) *messageEditorModel {
+	ta := textarea.New()
+	ta.Prompt = ""
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 0
+	ta.MaxHeight = 0
+	ta.MaxWidth = 0
+	ta.SetValue(message)
+	for ta.Line() > 0 {
+		ta.CursorUp()
+	}
+	ta.CursorStart()
+	ta.Focus()
+
+	return &messageEditorModel{textarea: ta, convention: convention}
+}
+
+func (m *messageEditorModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m *messageEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			m.result = editorCancelled
+			return m, tea.Quit
+		case "ctrl+s":
+			if strings.TrimSpace(m.textarea.Value()) == "" {
+				m.err = "The message cannot be empty"
+				return m, nil
+			}
+			m.result = editorSaved
+			return m, tea.Quit
+		case "ctrl+o":
+			m.result = editorExternal
+			return m, tea.Quit
+		}
+		m.err = ""
+	case tea.WindowSizeMsg:
+		// Title, ruler, border, status and hint
+		m.textarea.SetWidth(max(msg.Width-4, 20))
+		m.textarea.SetHeight(max(msg.Height-8, 3))
+		m.ready = true
+	}
+
+	var cmd tea.Cmd
+	m.textarea, cmd = m.textarea.Update(msg)
+	return m, cmd
+}
+
+// renderRuler renders a ruler as wide as the text, marking the last column
+// of the subject and of the body lines.
+func (m *messageEditorModel) renderRuler() string {
+	var ruler strings.Builder
+	for col := 1; col <= m.textarea.Width(); col++ {
+		switch col {
+		case m.convention.MaxSubjectLength:
+			ruler.WriteString(editorLimitStyle.Render("┴"))
+		case m.convention.BodyWidth:
+			ruler.WriteString(editorWidthStyle.Render("┴"))
+		default:
+			ruler.WriteString(editorRulerStyle.Render("─"))
+		}
+	}
+
+	return ruler.String()
+}
+
+// renderStatus renders the subject length and the body lines that are too
+// long.
+func (m *messageEditorModel) renderStatus() string {
+	if m.err != "" {
+		return editorStatusStyle.Render(editorErrorStyle.Render(m.err))
+	}
+
+	lines := strings.Split(m.textarea.Value(), "\n")
+
+	subjectStyle := editorOkStyle
+	length := utf8.RuneCountInString(lines[0])
+	if length > m.convention.MaxSubjectLength {
+		subjectStyle = editorErrorStyle
+	}
+	status := subjectStyle.Render(fmt.Sprintf("Subject %d/%d", length, m.convention.MaxSubjectLength))
+
+	tooLong := 0
+	for _, line := range lines[1:] {
+		if utf8.RuneCountInString(line) > m.convention.BodyWidth {
+			tooLong++
+		}
+	}
+	if tooLong > 0 {
+		status += editorRulerStyle.Render(" • ") + editorLimitStyle.Render(
+			fmt.Sprintf("%d body lines longer than %d columns", tooLong, m.convention.BodyWidth),
+		)
+	}
+
+	return editorStatusStyle.Render(status)
+}
+
+func (m *messageEditorModel) View() string {
+	if !m.ready {
+		return "\n  Initializing..."
+	}
+
+	editorStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#F780E2")).
+		Padding(0, 1)
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		editorTitleStyle.Render("Edit Commit Message:"),
+		editorStyle.Render(lipgloss.JoinVertical(lipgloss.Left, m.renderRuler(), m.textarea.View())),
+		m.renderStatus(),
+		editorHintStyle.Render("Ctrl+S to save • Ctrl+O to open in your editor • Esc to cancel"),
+	)
+}
+
+// editMessage lets the user edit message in the built-in editor. With
+// editorExternal, the returned message holds the edits made so far.
+func editMessage(message string, convention *service.Convention) (string, editorResult, error) {
+	model := newMessageEditorModel(message, convention)
+	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+		return "", editorCancelled, fmt.Errorf("failed to run the message editor. %v", err)
+	}
+
+	return model.textarea.Value(), model.result, nil
+}
@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fatih/color"
+	"github.com/spf13/viper"
 
 	"github.com/tfkhdyt/geminicommit/internal/service"
 )
@@ -23,7 +28,11 @@ const (
 	regenerate action = "REGENERATE"
 	clue       action = "CLUE"
 	edit       action = "EDIT"
-	cancel     action = "CANCEL"
+	editFields action = "EDIT_FIELDS"
+	// markBreaking accepts the detected breaking changes.
+	markBreaking action = "MARK_BREAKING"
+	coAuthor     action = "CO_AUTHOR"
+	cancel       action = "CANCEL"
 )
 
 type appState int
@@ -46,8 +55,15 @@ type commitModel struct {
 	inputText      string
 	inputCursor    int
 	editMode       bool
-	width          int
-	height         int
+	warnings       []string
+	breaking       []service.BreakingChange
+	// files are the staged files shown in the diff tab, fileIndex the one
+	// shown.
+	files     []diffFile
+	fileIndex int
+	showDiff  bool
+	width     int
+	height    int
 }
 
 type option struct {
@@ -64,12 +80,20 @@ func tickCmd() tea.Cmd {
 	})
 }
 
-func newCommitModel(content string, editMode bool) *commitModel {
+func newCommitModel(
+	content string,
+	editMode bool,
+	structured bool,
+	warnings []string,
+	breaking []service.BreakingChange,
+	files []diffFile,
+) *commitModel {
 	options := []option{
 		{"Yes", confirm},
 		{"Regenerate", regenerate},
 		{"Add Clue", clue},
 		{"Edit", edit},
+		{"Add Co-authors", coAuthor},
 		{"Cancel", cancel},
 	}
 
@@ -79,16 +103,34 @@ func newCommitModel(content string, editMode bool) *commitModel {
 			{"Edit Again", edit},
 			{"Regenerate", regenerate},
 			{"Add Clue", clue},
+			{"Add Co-authors", coAuthor},
 			{"Cancel", cancel},
 		}
 	}
 
+	// The fields of the generated message can be edited until it is
+	// rewritten as a whole
+	if structured {
+		idx := slices.IndexFunc(options, func(o option) bool { return o.action == edit })
+		options = slices.Insert(options, idx+1, option{"Edit Fields", editFields})
+	}
+
+	// Detected breaking changes may be false positives, so the message is
+	// only marked as breaking on request
+	if len(breaking) > 0 && !service.HasBreakingChange(content) {
+		idx := slices.IndexFunc(options, func(o option) bool { return o.action == coAuthor })
+		options = slices.Insert(options, idx, option{"Mark as Breaking", markBreaking})
+	}
+
 	return &commitModel{
 		content:  content,
 		state:    stateViewing,
 		options:  options,
 		cursor:   0,
 		editMode: editMode,
+		warnings: warnings,
+		breaking: breaking,
+		files:    files,
 	}
 }
 
@@ -128,12 +170,40 @@ func (m *commitModel) handleViewingKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.viewport.LineUp(1)
 	case "down", "j":
 		m.viewport.LineDown(1)
+	case "d":
+		if len(m.files) > 0 {
+			m.showDiff = !m.showDiff
+			m.updateViewport()
+		}
+	case "left", "h", "p":
+		if m.showDiff && m.fileIndex > 0 {
+			m.fileIndex--
+			m.updateViewport()
+		}
+	case "right", "l", "n":
+		if m.showDiff && m.fileIndex < len(m.files)-1 {
+			m.fileIndex++
+			m.updateViewport()
+		}
 	case "tab", "enter":
 		m.state = stateSelecting
 	}
 	return m, nil
 }
 
+// updateViewport shows the message or the diff of the current file,
+// depending on the tab.
+func (m *commitModel) updateViewport() {
+	// The tabs and the file name may wrap differently
+	m.updateLayout()
+	if m.showDiff {
+		m.viewport.SetContent(m.files[m.fileIndex].content)
+	} else {
+		m.viewport.SetContent(m.content)
+	}
+	m.viewport.GotoTop()
+}
+
 func (m *commitModel) handleSelectingKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c":
@@ -154,6 +224,7 @@ func (m *commitModel) handleSelectingKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.state = stateInputting
 			m.inputText = ""
 			m.inputCursor = 0
+			m.updateLayout()
 		} else {
 			m.selectedAction = selectedOption.action
 			m.completed = true
@@ -169,6 +240,7 @@ func (m *commitModel) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, tea.Quit
 	case "escape":
 		m.state = stateSelecting
+		m.updateLayout()
 	case "enter":
 		m.selectedAction = clue
 		m.completed = true
@@ -200,29 +272,24 @@ func (m *commitModel) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m *commitModel) handleWindowResize(msg tea.WindowSizeMsg) (tea.Model, tea.Cmd) {
 	m.width = msg.Width
 	m.height = msg.Height
+	m.updateLayout()
 
-	// Measure actual component heights by rendering them - matches View() exactly
-	headerStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#F780E2")).
-		Bold(true).
-		Padding(0, 0, 1, 0)
-	header := headerStyle.Render("Generated Commit Message:")
-
-	navHintStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#666")).
-		Italic(true).
-		Padding(1, 0, 0, 0)
+	return m, nil
+}
 
-	var navHint string
-	switch m.state {
-	case stateViewing:
-		navHint = navHintStyle.Render("↑/↓ to scroll • Tab/Enter to select options")
-	case stateSelecting:
-		navHint = navHintStyle.Render("↑/↓ to navigate • Enter to select • Tab to view message")
-	case stateInputting:
-		navHint = navHintStyle.Render("Type your clue • Enter to confirm • Escape to cancel")
+// updateLayout sizes the viewport to the space the other components leave,
+// which changes with the window size, the tab, the file shown and the state.
+func (m *commitModel) updateLayout() {
+	if m.width == 0 {
+		// The window size is not known yet
+		return
 	}
 
+	// Measure actual component heights by rendering them - matches View() exactly
+	header := m.renderHeader()
+
+	navHint := m.renderNavHint()
+
 	// Render the content area to measure its height
 	var contentArea string
 	switch m.state {
@@ -240,7 +307,7 @@ func (m *commitModel) handleWindowResize(msg tea.WindowSizeMsg) (tea.Model, tea.
 
 	// Calculate available height for viewport
 	usedHeight := headerHeight + navHintHeight + contentHeight + borderPadding
-	viewportHeight := msg.Height - usedHeight
+	viewportHeight := m.height - usedHeight
 
 	// Ensure minimum height
 	if viewportHeight < 3 {
@@ -248,15 +315,13 @@ func (m *commitModel) handleWindowResize(msg tea.WindowSizeMsg) (tea.Model, tea.
 	}
 
 	if !m.ready {
-		m.viewport = viewport.New(msg.Width-4, viewportHeight)
+		m.viewport = viewport.New(m.width-4, viewportHeight)
 		m.viewport.SetContent(m.content)
 		m.ready = true
 	} else {
-		m.viewport.Width = msg.Width - 4
+		m.viewport.Width = m.width - 4
 		m.viewport.Height = viewportHeight
 	}
-
-	return m, nil
 }
 
 // Helper methods to render components for measurement - must match actual rendering exactly
@@ -310,13 +375,7 @@ func (m *commitModel) View() string {
 		return "\n  Initializing..."
 	}
 
-	// Simple header
-	headerStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#F780E2")).
-		Bold(true).
-		Padding(0, 0, 1, 0)
-
-	header := headerStyle.Render("Generated Commit Message:")
+	header := m.renderHeader()
 
 	// Clean viewport styling
 	viewportStyle := lipgloss.NewStyle().
@@ -331,21 +390,7 @@ func (m *commitModel) View() string {
 
 	viewportContent := viewportStyle.Render(m.viewport.View())
 
-	// Simple navigation hints
-	navHintStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#666")).
-		Italic(true).
-		Padding(1, 0, 0, 0)
-
-	var navHint string
-	switch m.state {
-	case stateViewing:
-		navHint = navHintStyle.Render("↑/↓ to scroll • Tab/Enter to select options")
-	case stateSelecting:
-		navHint = navHintStyle.Render("↑/↓ to navigate • Enter to select • Tab to view message")
-	case stateInputting:
-		navHint = navHintStyle.Render("Type your clue • Enter to confirm • Escape to cancel")
-	}
+	navHint := m.renderNavHint()
 
 	// Content area
 	var contentArea string
@@ -366,6 +411,90 @@ func (m *commitModel) View() string {
 	)
 }
 
+// renderNavHint renders the keys of the current state and tab.
+func (m *commitModel) renderNavHint() string {
+	navHintStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#666")).
+		Italic(true).
+		Padding(1, 0, 0, 0)
+
+	var navHint string
+	switch {
+	case m.state == stateViewing && m.showDiff:
+		navHint = "↑/↓ to scroll • ←/→ to switch files • d to view message • Tab/Enter to select options"
+	case m.state == stateViewing && len(m.files) > 0:
+		navHint = "↑/↓ to scroll • d to view diff • Tab/Enter to select options"
+	case m.state == stateViewing:
+		navHint = "↑/↓ to scroll • Tab/Enter to select options"
+	case m.state == stateSelecting:
+		navHint = "↑/↓ to navigate • Enter to select • Tab to view message"
+	case m.state == stateInputting:
+		navHint = "Type your clue • Enter to confirm • Escape to cancel"
+	}
+
+	return m.wrapToWidth(navHintStyle.Render(navHint))
+}
+
+// renderHeader renders the title, followed by the probable breaking changes
+// of the diff and the convention lint warnings of the message if any.
+func (m *commitModel) renderHeader() string {
+	headerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#F780E2")).
+		Bold(true).
+		Padding(0, 0, 1, 0)
+
+	header := headerStyle.Render("Generated Commit Message:")
+	if len(m.files) > 0 {
+		header = headerStyle.Render(m.renderTabs())
+	}
+	if len(m.warnings) == 0 && len(m.breaking) == 0 {
+		return m.wrapToWidth(header)
+	}
+
+	breakingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+	warningStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#E5C07B"))
+
+	var warnings strings.Builder
+	for _, change := range m.breaking {
+		warnings.WriteString(breakingStyle.Render("‼ Breaking: "+change.String()) + "\n")
+	}
+	for _, warning := range m.warnings {
+		warnings.WriteString(warningStyle.Render("⚠ "+warning) + "\n")
+	}
+
+	return m.wrapToWidth(lipgloss.JoinVertical(lipgloss.Left, header, warnings.String()))
+}
+
+// wrapToWidth wraps s at the window width, so that the height measured by
+// updateLayout is the one the terminal shows.
+func (m *commitModel) wrapToWidth(s string) string {
+	if m.width == 0 {
+		return s
+	}
+
+	return lipgloss.NewStyle().Width(m.width).Render(s)
+}
+
+// renderTabs renders the tab bar of the message and the staged diff, which
+// names the file shown.
+func (m *commitModel) renderTabs() string {
+	activeStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#F780E2")).Bold(true)
+	inactiveStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666"))
+
+	message, diff := activeStyle, inactiveStyle
+	if m.showDiff {
+		message, diff = inactiveStyle, activeStyle
+	}
+
+	tabs := message.Render("Generated Commit Message") + inactiveStyle.Render(" │ ") + diff.Render("Staged Diff")
+	if m.showDiff {
+		file := m.files[m.fileIndex]
+		tabs += diff.Render(fmt.Sprintf(" (%d/%d) ", m.fileIndex+1, len(m.files))) + file.path
+	}
+
+	return tabs
+}
+
 func (m *commitModel) renderMenu() string {
 	// Simple menu container
 	menuStyle := lipgloss.NewStyle().
@@ -430,16 +559,15 @@ func (m *commitModel) renderInput() string {
 	)
 }
 
-func displayCommitMessageWithOptions(content string) (action, string) {
-	return displayCommitMessageWithCustomOptions(content, false)
-}
-
-func displayCommitMessageWithEditOptions(content string) (action, string) {
-	return displayCommitMessageWithCustomOptions(content, true)
-}
-
-func displayCommitMessageWithCustomOptions(content string, editMode bool) (action, string) {
-	model := newCommitModel(content, editMode)
+func displayCommitMessageWithCustomOptions(
+	content string,
+	editMode bool,
+	structured bool,
+	warnings []string,
+	breaking []service.BreakingChange,
+	files []diffFile,
+) (action, string) {
+	model := newCommitModel(content, editMode, structured, warnings, breaking, files)
 
 	p := tea.NewProgram(model, tea.WithAltScreen())
 	finalModel, err := p.Run()
@@ -460,18 +588,60 @@ func displayCommitMessageWithCustomOptions(content string, editMode bool) (actio
 }
 
 type RootUsecase struct {
-	gitService    *service.GitService
-	geminiService *service.GeminiService
+	gitService     service.GitService
+	geminiService  *service.GeminiService
+	historyService *service.HistoryService
+	usageService   *service.UsageService
 }
 
 func NewRootUsecase(
-	gitService *service.GitService,
+	gitService service.GitService,
 	geminiService *service.GeminiService,
+	historyService *service.HistoryService,
+	usageService *service.UsageService,
 ) *RootUsecase {
-	return &RootUsecase{gitService, geminiService}
+	return &RootUsecase{gitService, geminiService, historyService, usageService}
 }
 
-func (r *RootUsecase) RootCommand(stageAll *bool, promptAddition *string) error {
+// RootCommand generates a commit message for the staged changes and commits
+// them once reviewed. With the json output, the first message is committed
+// without review and a commitReport is printed instead of the usual output.
+func (r *RootUsecase) RootCommand(
+	stageAll *bool,
+	interactive *bool,
+	promptAddition *string,
+	output string,
+) (err error) {
+	var report *commitReport
+	switch output {
+	case "", OutputText:
+	case OutputJSON:
+		report = newCommitReport()
+		flush := redirectOutput(report)
+		defer func() {
+			if err != nil {
+				report.Error = err.Error()
+			}
+			if flushErr := flush(); err == nil {
+				err = flushErr
+			}
+		}()
+	default:
+		return fmt.Errorf(
+			"invalid output format %q. expected %s or %s",
+			output,
+			OutputText,
+			OutputJSON,
+		)
+	}
+	jsonOutput := report != nil
+	if jsonOutput && *interactive {
+		return fmt.Errorf("--interactive cannot be used with --output %s", OutputJSON)
+	}
+	if jsonOutput && viper.GetString("api.key") == "" {
+		return fmt.Errorf("API key is still empty, run `geminicommit config key set api_key` to set your API key")
+	}
+
 	if err := r.gitService.VerifyGitInstallation(); err != nil {
 		return err
 	}
@@ -480,53 +650,52 @@ func (r *RootUsecase) RootCommand(stageAll *bool, promptAddition *string) error
 		return err
 	}
 
-	hasHook, _ := r.gitService.HasPreCommitHook()
-	if hasHook {
-		hookPath, _ := r.gitService.PreCommitHookPath()
-		if r.gitService.IsExecutable(hookPath) {
-			color.New(color.FgGreen).Println("✔ Running pre-commit hook...")
-			err := r.gitService.RunPreCommitHook(hookPath)
-			if err != nil {
-				color.New(color.FgRed).Printf("Pre-commit hook failed: %v\n", err)
-				return err
-			}
-			color.New(color.FgGreen).Println("✔ Pre-commit hook ran successfully.")
-		}
-	}
 	if *stageAll {
 		if err := r.gitService.StageAll(); err != nil {
 			return err
 		}
 	}
 
-	filesChan := make(chan []string, 1)
-	deletedFilesChan := make(chan []string, 1)
-	diffChan := make(chan string, 1)
+	if *interactive {
+		if err := r.stageInteractively(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.runPreCommitHook(!jsonOutput); err != nil {
+		return err
+	}
+
+	changesChan := make(chan *service.StagedChanges, 1)
+	// readBlob reads the Go files of the changes, set before they are sent
+	var readBlob func(hash string) ([]byte, error)
 
 	color.New(color.FgYellow).Print("Detecting staged files...")
 	go func() {
-		files, deletedFiles, diff, err := r.gitService.DetectDiffChanges()
+		changes, err := r.gitService.DetectDiffChanges()
 		if err != nil {
-			filesChan <- []string{}
-			deletedFilesChan <- []string{}
-			diffChan <- ""
+			changesChan <- &service.StagedChanges{}
 			return
 		}
+		// Blobs that cannot be read only leave their files without Go context
+		blobs, _ := r.gitService.ReadBlobs(changes.GoBlobHashes())
+		readBlob = service.BlobReader(blobs)
+		if viper.GetBool("diff.go_context") {
+			service.EnrichGoContext(changes, readBlob)
+		}
 
-		filesChan <- files
-		deletedFilesChan <- deletedFiles
-		diffChan <- diff
+		changesChan <- changes
 	}()
 
 	underline := color.New(color.Underline)
-	files, deletedFiles, diff := <-filesChan, <-deletedFilesChan, <-diffChan
+	changes := <-changesChan
 
 	color.New(color.FgGreen).Println(" ✓")
 
-	totalFiles := len(files) + len(deletedFiles)
+	totalFiles := len(changes.Files)
 	if totalFiles == 0 {
 		return fmt.Errorf(
-			"no staged changes found. stage your changes manually, or automatically stage all changes with the `--all` flag",
+			"no staged changes found. stage your changes manually, pick them with the `--interactive` flag, or automatically stage all changes to tracked files with the `--all` flag",
 		)
 	}
 
@@ -536,121 +705,816 @@ func (r *RootUsecase) RootCommand(stageAll *bool, promptAddition *string) error
 		underline.Printf("Detected %d staged files:\n", totalFiles)
 	}
 
-	idx := 1
-	for _, file := range files {
-		color.New(color.Bold).Printf("     %d. %s\n", idx, file)
-		idx++
+	printStagedFiles(changes)
+	breaking := service.DetectBreakingChanges(changes, readBlob)
+	printBreakingChanges(breaking)
+	if jsonOutput {
+		report.addChanges(changes)
+		report.addBreakingChanges(breaking)
 	}
 
-	for _, file := range deletedFiles {
-		color.New(color.Bold, color.FgRed).Printf("     %d. %s (deleted)\n", idx, file)
-		idx++
+	convention, err := service.ConventionByName(viper.GetString("message.convention"))
+	if err != nil {
+		return err
+	}
+
+	detail, err := resolveDetailLevel(changes)
+	if err != nil {
+		return err
 	}
 
+	styleExamples, err := r.loadStyleExamples()
+	if err != nil {
+		return err
+	}
+
+	// The message can still be generated without the template
+	template, err := r.gitService.CommitTemplate()
+	if err != nil {
+		color.New(color.FgYellow).Printf("Warning: ignoring the commit template. %v\n", err)
+		template = ""
+	}
+	commentChar, err := r.gitService.CommentChar()
+	if err != nil {
+		return err
+	}
+
+	ticket, err := r.detectTicket()
+	if err != nil {
+		return err
+	}
+
+	history := r.newHistoryEntry(changes)
+
+	var diffFiles []diffFile
+	if !jsonOutput {
+		diffFiles = newDiffFiles(changes)
+	}
+
+	// Only the first generation may come from the cache, regenerating asks
+	// for a new message
+	skipCache := false
+
 generate:
 	for {
-		messageChan := make(chan string, 1)
+		resultChan := make(chan *service.AnalyzeResult, 1)
+		errChan := make(chan error, 1)
 
 		titleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#F780E2"))
 		fmt.Print(titleStyle.Render("The AI is analyzing your changes..."))
 
 		go func() {
-			message, err := r.geminiService.AnalyzeChanges(context.Background(), diff, deletedFiles, promptAddition)
+			result, err := r.geminiService.AnalyzeChanges(
+				context.Background(),
+				changes,
+				service.AnalyzeOptions{
+					PromptAddition:  promptAddition,
+					StyleExamples:   styleExamples,
+					Template:        template,
+					CommentChar:     commentChar,
+					Detail:          detail,
+					BreakingChanges: breaking,
+					SkipCache:       skipCache,
+					OnRetry:         printRetry,
+					OnFallback:      printFallback,
+				},
+			)
 			if err != nil {
-				messageChan <- ""
+				errChan <- err
 				return
 			}
 
-			messageChan <- message
+			resultChan <- result
 		}()
 
-		message := <-messageChan
+		var result *service.AnalyzeResult
+		select {
+		case result = <-resultChan:
+		case err := <-errChan:
+			color.New(color.FgRed).Println(" ✗")
+			return err
+		}
+		message := result.Message
+		structured := result.Structured
+		var coAuthors []service.Trailer
+		skipCache = true
 
 		color.New(color.FgGreen).Println(" ✓")
 		fmt.Print("\n")
 		underline.Println("Changes analyzed!")
+		printAnalyzeResult(result)
+		if result.Usage != nil {
+			recordUsage(r.usageService, history.Repo, result)
+		}
 
 		if strings.TrimSpace(message) == "" {
 			return fmt.Errorf("no commit messages were generated. try again")
 		}
 
-		selectedAction, clueText := displayCommitMessageWithOptions(message)
+		if message, err = r.finishMessage(message, ticket); err != nil {
+			return err
+		}
+
+		history.Candidates = append(history.Candidates, message)
+		history.Model = result.Model
+		history.FinalMessage = message
+		if promptAddition != nil {
+			history.Clue = *promptAddition
+		}
+		r.saveHistory(history)
+
+		if jsonOutput {
+			report.Model = result.Model
+			report.Usage = result.Usage
+			report.Cached = result.Cached
+			report.Candidates = history.Candidates
+			report.Fields = result.Structured
+			report.Warnings = convention.Lint(message, ticket, viper.GetString("ticket.subject_template"))
+			report.Message = message
 
-		switch selectedAction {
-		case confirm:
 			if err := r.gitService.CommitChanges(message); err != nil {
 				return err
 			}
-			color.New(color.FgGreen).Println("✔ Successfully committed!")
-			break generate
-		case regenerate:
-			continue
-		case clue:
-			if strings.TrimSpace(clueText) != "" {
-				promptAddition = &clueText
-				fmt.Print("\n")
-				color.New(color.Italic).Println("Regenerating with provided clue...")
-				fmt.Print("\n")
-			} else {
-				promptAddition = nil
-			}
-			continue generate
-		case edit:
-			for {
-				tmpDir := os.TempDir()
-				tmpFile, _ := os.CreateTemp(tmpDir, "COMMIT_EDITMSG")
-				_ = os.WriteFile(tmpFile.Name(), []byte(message), 0o644)
-
-				editor := os.Getenv("EDITOR")
-				cmd := exec.Command(editor, tmpFile.Name())
-				cmd.Dir = tmpDir
-				cmd.Stdin = os.Stdin
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-
-				if err := cmd.Run(); err != nil {
+			history.Outcome = service.OutcomeCommitted
+			r.saveHistory(history)
+
+			report.Commit, err = r.gitService.HeadCommit()
+			return err
+		}
+
+		editMode := false
+		for {
+			selectedAction, clueText := displayCommitMessageWithCustomOptions(
+				message,
+				editMode,
+				structured != nil,
+				convention.Lint(message, ticket, viper.GetString("ticket.subject_template")),
+				breaking,
+				diffFiles,
+			)
+
+			switch selectedAction {
+			case confirm:
+				if err := r.gitService.CommitChanges(message); err != nil {
 					return err
 				}
-
-				msg, _ := os.ReadFile(tmpFile.Name())
-				message = string(msg)
-				_ = os.Remove(tmpFile.Name())
+				color.New(color.FgGreen).Println("✔ Successfully committed!")
+				history.Outcome = service.OutcomeCommitted
+				r.saveHistory(history)
+				break generate
+			case regenerate:
+				continue generate
+			case clue:
+				if strings.TrimSpace(clueText) != "" {
+					promptAddition = &clueText
+					fmt.Print("\n")
+					color.New(color.Italic).Println("Regenerating with provided clue...")
+					fmt.Print("\n")
+				} else {
+					promptAddition = nil
+				}
+				continue generate
+			case edit:
+				edited, result, err := editMessage(message, convention)
+				if err != nil {
+					return err
+				}
+				switch result {
+				case editorCancelled:
+					continue
+				case editorExternal:
+					if edited, err = r.editInExternalEditor(edited, changes); err != nil {
+						return err
+					}
+				}
+				message = edited
 
 				underline.Print("Commit message edited!")
 				fmt.Print("\n")
-				selectedAction, clueText := displayCommitMessageWithEditOptions(message)
+				editMode = true
+				structured = nil
+				history.FinalMessage = message
+				r.saveHistory(history)
+			case editFields:
+				if err := editMessageFields(structured, convention); err != nil {
+					return err
+				}
+				if message, err = r.reassembleMessage(structured, convention, ticket, coAuthors); err != nil {
+					return err
+				}
 
-				switch selectedAction {
-				case confirm:
-					if err := r.gitService.CommitChanges(message); err != nil {
-						return err
-					}
-					color.New(color.FgGreen).Println("✔ Successfully committed!")
-					return nil
-				case edit:
-					continue
-				case regenerate:
-					continue generate
-				case clue:
-					if strings.TrimSpace(clueText) != "" {
-						promptAddition = &clueText
-						fmt.Print("\n")
-						color.New(color.Italic).Println("Regenerating with provided clue...")
-						fmt.Print("\n")
-					} else {
-						promptAddition = nil
-					}
-					continue generate
-				case cancel:
-					color.New(color.FgRed).Println("Commit cancelled")
-					return nil
+				editMode = true
+				history.FinalMessage = message
+				r.saveHistory(history)
+			case markBreaking:
+				description := service.DescribeBreakingChanges(breaking)
+				if structured != nil {
+					structured.BreakingChange = description
+					message, err = r.reassembleMessage(structured, convention, ticket, coAuthors)
+				} else {
+					message, err = convention.EnsureBreakingChange(
+						message,
+						description,
+						ticket,
+						viper.GetString("ticket.subject_template"),
+					)
+				}
+				if err != nil {
+					return err
+				}
+
+				history.FinalMessage = message
+				r.saveHistory(history)
+			case coAuthor:
+				selected, err := r.pickCoAuthors()
+				if err != nil {
+					return err
+				}
+				if message, err = service.ApplyTrailers(message, selected, service.TrailerAddIfDifferent); err != nil {
+					return err
+				}
+				coAuthors = append(coAuthors, selected...)
+				history.FinalMessage = message
+				r.saveHistory(history)
+			case cancel:
+				color.New(color.FgRed).Println("Commit cancelled")
+				history.Outcome = service.OutcomeCancelled
+				r.saveHistory(history)
+				break generate
+			}
+		}
+	}
+
+	return nil
+}
+
+// editInExternalEditor lets the user edit message in the editor git would
+// use, in .git/COMMIT_EDITMSG laid out like `git commit -v` does. An empty
+// message keeps the current one.
+func (r *RootUsecase) editInExternalEditor(
+	message string,
+	changes *service.StagedChanges,
+) (string, error) {
+	editor, err := r.gitService.Editor()
+	if err != nil {
+		return "", err
+	}
+
+	gitDir, err := r.gitService.GitDir()
+	if err != nil {
+		return "", err
+	}
+
+	branch, err := r.gitService.CurrentBranch()
+	if err != nil {
+		return "", err
+	}
+
+	commentChar, err := r.gitService.CommentChar()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(gitDir, "COMMIT_EDITMSG")
+	content := service.CommitMessageFile(message, changes, branch, commentChar)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s. %v", path, err)
+	}
+
+	cmd := editorCommand(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run editor %q. %v", editor, err)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s. %v", path, err)
+	}
+
+	if edited := service.CleanupMessage(string(edited), commentChar); edited != "" {
+		return edited, nil
+	}
+
+	color.New(color.FgYellow).Println("The edited message is empty, keeping the previous one.")
+	return message, nil
+}
+
+// editorCommand runs editor on path through the shell like git does, since
+// the editor may come with arguments or quotes, e.g. "code --wait".
+func editorCommand(editor, path string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		args := strings.Fields(editor)
+		return exec.Command(args[0], append(args[1:], path)...)
+	}
+
+	return exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+}
+
+// recentAuthorsCommits is how far back in history co-author candidates are
+// looked up.
+const recentAuthorsCommits = 500
+
+// pickCoAuthors lets the user pick co-authors among the recent authors of the
+// repository and returns them as Co-authored-by trailers.
+func (r *RootUsecase) pickCoAuthors() ([]service.Trailer, error) {
+	authors, err := r.gitService.RecentAuthors(recentAuthorsCommits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Committing already credits the current user
+	if self, err := r.gitService.UserIdentity(); err == nil {
+		authors = slices.DeleteFunc(authors, func(author string) bool {
+			return authorEmail(author) == authorEmail(self)
+		})
+	}
+
+	if len(authors) == 0 {
+		color.New(color.FgYellow).Println("No other authors found in the recent history.")
+		return nil, nil
+	}
+
+	var selected []string
+	if err := huh.NewMultiSelect[string]().
+		Title("Select co-authors").
+		Description("Space to toggle • Enter to confirm").
+		Options(huh.NewOptions(authors...)...).
+		Value(&selected).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return nil, err
+	}
+
+	trailers := make([]service.Trailer, 0, len(selected))
+	for _, author := range selected {
+		trailers = append(trailers, service.Trailer{Key: "Co-authored-by", Value: author})
+	}
+
+	return trailers, nil
+}
+
+// editMessageFields lets the user edit the fields of a generated message in
+// place.
+func editMessageFields(msg *service.StructuredMessage, convention *service.Convention) error {
+	// Free-form body items span several lines, so they are separated by
+	// blank lines instead
+	itemSeparator, bodyDescription := "\n", "One item per line, wrapped for you"
+	if msg.FreeFormBody {
+		itemSeparator, bodyDescription = "\n\n", "Paragraphs separated by a blank line, line breaks are kept"
+	}
+	body := strings.Join(msg.Body, itemSeparator)
+
+	var fields []huh.Field
+	if convention.HasType() {
+		fields = append(fields, huh.NewInput().Title("Type").Value(&msg.Type))
+	}
+	if convention.HasScope() {
+		fields = append(fields, huh.NewInput().Title("Scope").Value(&msg.Scope))
+	}
+	fields = append(
+		fields,
+		huh.NewInput().
+			Title("Subject").
+			CharLimit(convention.MaxSubjectLength).
+			Value(&msg.Subject).
+			Validate(func(subject string) error {
+				if strings.TrimSpace(subject) == "" {
+					return fmt.Errorf("subject cannot be empty")
 				}
+				return nil
+			}),
+		huh.NewText().
+			Title("Body").
+			Description(bodyDescription).
+			Value(&body),
+		huh.NewInput().
+			Title("Breaking change").
+			Description("What breaks and how to migrate, empty when nothing does").
+			Value(&msg.BreakingChange),
+	)
+
+	if err := huh.NewForm(huh.NewGroup(fields...)).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run(); err != nil {
+		return err
+	}
+
+	msg.Body = strings.Split(body, itemSeparator)
+
+	return nil
+}
+
+// reassembleMessage assembles the edited fields of a generated message and
+// adds the ticket, the configured trailers and the chosen co-authors back.
+func (r *RootUsecase) reassembleMessage(
+	structured *service.StructuredMessage,
+	convention *service.Convention,
+	ticket string,
+	coAuthors []service.Trailer,
+) (string, error) {
+	message, err := r.finishMessage(convention.Assemble(structured), ticket)
+	if err != nil {
+		return "", err
+	}
+
+	return service.ApplyTrailers(message, coAuthors, service.TrailerAddIfDifferent)
+}
+
+// finishMessage adds the detected ticket and the configured trailers to a
+// generated message.
+func (r *RootUsecase) finishMessage(message, ticket string) (string, error) {
+	message, err := service.ApplyTicket(
+		message,
+		ticket,
+		viper.GetString("ticket.subject_template"),
+		ticketTrailerKey(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return r.applyConfiguredTrailers(message)
+}
+
+// authorEmail extracts the lowercased email of a "Name <email>" identity.
+func authorEmail(ident string) string {
+	if start := strings.LastIndex(ident, "<"); start != -1 {
+		ident = ident[start+1:]
+	}
+
+	return strings.ToLower(strings.TrimSuffix(ident, ">"))
+}
+
+// applyConfiguredTrailers adds the `trailers.add` trailers, and a
+// Signed-off-by trailer with `trailers.signoff`, honoring
+// `trailers.if_exists`.
+func (r *RootUsecase) applyConfiguredTrailers(message string) (string, error) {
+	var trailers []service.Trailer
+	for _, value := range viper.GetStringSlice("trailers.add") {
+		trailer, err := service.ParseTrailer(value)
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer)
+	}
+
+	if viper.GetBool("trailers.signoff") {
+		ident, err := r.gitService.UserIdentity()
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, service.Trailer{Key: "Signed-off-by", Value: ident})
+	}
+
+	if len(trailers) == 0 {
+		return message, nil
+	}
+
+	return service.ApplyTrailers(message, trailers, viper.GetString("trailers.if_exists"))
+}
+
+// printRetry tells the user that a failed request is about to be retried.
+func printRetry(err *service.GenerationError, retry, maxRetries int, delay time.Duration) {
+	color.New(color.FgYellow).Printf(
+		"\n%s, retrying in %s (%d/%d)...",
+		err.Kind,
+		delay.Round(100*time.Millisecond),
+		retry,
+		maxRetries,
+	)
+}
+
+// printFallback tells the user that a model failed and the next one is
+// tried.
+func printFallback(err *service.GenerationError, next string) {
+	color.New(color.FgYellow).Printf("\n%s: %s, falling back to %s...", err.Model, err.Kind, next)
+}
+
+// printAnalyzeResult tells which model produced the message and how many
+// tokens it took.
+func printAnalyzeResult(result *service.AnalyzeResult) {
+	if result.Usage != nil {
+		color.New(color.Italic).Printf(
+			"Generated by %s (%d prompt + %d response tokens)\n",
+			result.Model,
+			result.Usage.PromptTokens,
+			result.Usage.ResponseTokens,
+		)
+	} else {
+		color.New(color.Italic).Printf("Generated by %s\n", result.Model)
+	}
+
+	if result.Cached {
+		color.New(color.Italic).Println(
+			"Reusing the message cached for these changes, regenerate for a new one",
+		)
+	}
+}
+
+// recordUsage saves the token usage of result, only warning on failure.
+func recordUsage(
+	usageService *service.UsageService,
+	repo string,
+	result *service.AnalyzeResult,
+) {
+	err := usageService.Record(service.UsageRecord{
+		Timestamp:  time.Now(),
+		Repo:       repo,
+		Model:      result.Model,
+		TokenUsage: *result.Usage,
+	})
+	if err != nil {
+		color.New(color.FgYellow).Printf("Warning: %v\n", err)
+	}
+}
+
+// newHistoryEntry starts the history entry of a generation session for
+// changes.
+func (r *RootUsecase) newHistoryEntry(changes *service.StagedChanges) *service.HistoryEntry {
+	entry := service.NewHistoryEntry()
+	entry.DiffHash = changes.Hash()
+	entry.Model = r.geminiService.ModelName()
+	// Both are best effort, an entry without them is still worth keeping
+	entry.Repo, _ = r.gitService.RepositoryRoot()
+	entry.Branch, _ = r.gitService.CurrentBranch()
+
+	return entry
+}
+
+// saveHistory records entry unless `history.enabled` is off. Failing to do so
+// is not worth aborting the commit for, so it only warns.
+func (r *RootUsecase) saveHistory(entry *service.HistoryEntry) {
+	if !viper.GetBool("history.enabled") {
+		return
+	}
+
+	if err := r.historyService.Save(entry); err != nil {
+		color.New(color.FgYellow).Printf("Warning: %v\n", err)
+	}
+}
+
+// resolveDetailLevel returns the `message.detail` level, suggesting one from
+// the size of the changes when it is unset or "auto".
+func resolveDetailLevel(changes *service.StagedChanges) (service.DetailLevel, error) {
+	detail, err := service.ParseDetailLevel(viper.GetString("message.detail"))
+	if err != nil {
+		return "", err
+	}
+
+	if detail == service.DetailAuto {
+		detail = service.SuggestDetailLevel(changes)
+		color.New(color.Italic).Printf(
+			"Using %s detail level for %d files and %d changed lines (override with --detail)\n",
+			detail,
+			len(changes.Files),
+			changes.ChangedLines(),
+		)
+	}
+
+	return detail, nil
+}
+
+// loadStyleExamples fetches the recent commit messages used as style
+// examples, as configured by the `style.*` keys. It returns nil when the
+// feature is disabled.
+func (r *RootUsecase) loadStyleExamples() ([]string, error) {
+	limit := viper.GetInt("style.examples")
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	examples, err := r.gitService.RecentCommitMessages(
+		limit,
+		viper.GetString("style.author"),
+		viper.GetStringSlice("style.paths"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(examples) > 0 {
+		color.New(color.Italic).Printf(
+			"Using %d recent commit messages as style examples\n",
+			len(examples),
+		)
+	}
+
+	return examples, nil
+}
+
+// detectTicket extracts the issue key from the current branch name with the
+// `ticket.pattern` regular expression. It returns an empty string when the
+// feature is disabled or nothing matches.
+func (r *RootUsecase) detectTicket() (string, error) {
+	pattern := viper.GetString("ticket.pattern")
+	if pattern == "" {
+		return "", nil
+	}
+
+	branch, err := r.gitService.CurrentBranch()
+	if err != nil {
+		return "", err
+	}
+
+	ticket, err := service.ExtractTicket(branch, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	if ticket != "" {
+		color.New(color.Italic).Printf("Detected ticket %s from branch %s\n", ticket, branch)
+	}
+
+	return ticket, nil
+}
+
+// ticketTrailerKey returns the trailer the ticket is added as, "Refs" unless
+// configured otherwise. An explicitly empty `ticket.trailer` disables it.
+func ticketTrailerKey() string {
+	if !viper.IsSet("ticket.trailer") {
+		return "Refs"
+	}
+
+	return viper.GetString("ticket.trailer")
+}
+
+// printStagedFiles lists the staged files, with renames, copies and mode
+// changes spelled out and deleted files last.
+func printStagedFiles(changes *service.StagedChanges) {
+	idx := 1
+	for _, file := range changes.Files {
+		if file.Status == service.StatusDeleted {
+			continue
+		}
+
+		line := file.Path
+		switch file.Status {
+		case service.StatusRenamed:
+			line = fmt.Sprintf("%s → %s (renamed, %d%% similar)", file.OldPath, file.Path, file.Similarity)
+		case service.StatusCopied:
+			line = fmt.Sprintf("%s → %s (copied, %d%% similar)", file.OldPath, file.Path, file.Similarity)
+		}
+		if file.ModeChanged() {
+			line += fmt.Sprintf(
+				" (%s → %s)",
+				service.DescribeMode(file.OldMode),
+				service.DescribeMode(file.NewMode),
+			)
+		}
+		if file.Summarized() && file.SizeKnown {
+			line += fmt.Sprintf(" [%s, %s]", file.Kind, file.SizeSummary())
+		} else if file.Summarized() {
+			line += fmt.Sprintf(" [%s]", file.Kind)
+		}
+		if file.IsSubmodule() && file.OldHash != "" && file.NewHash != "" {
+			line += fmt.Sprintf(
+				" (submodule %s → %s",
+				service.ShortHash(file.OldHash),
+				service.ShortHash(file.NewHash),
+			)
+			switch {
+			case file.SubmoduleLogCapped:
+				line += fmt.Sprintf(", %d+ commits", len(file.SubmoduleLog))
+			case len(file.SubmoduleLog) > 0:
+				line += fmt.Sprintf(", %d commits", len(file.SubmoduleLog))
+			case file.SubmoduleLogLoaded:
+				line += ", rewound"
 			}
-		case cancel:
-			color.New(color.FgRed).Println("Commit cancelled")
-			break generate
+			line += ")"
 		}
+
+		color.New(color.Bold).Printf("     %d. %s\n", idx, line)
+		idx++
+	}
+
+	for _, file := range changes.DeletedFiles() {
+		color.New(color.Bold, color.FgRed).Printf("     %d. %s (deleted)\n", idx, file)
+		idx++
+	}
+}
+
+// printBreakingChanges lists the probable breaking changes of the diff, which
+// the message is marked with once the model or the user confirms them.
+func printBreakingChanges(breaking []service.BreakingChange) {
+	if len(breaking) == 0 {
+		return
+	}
+
+	fmt.Print("\n")
+	color.New(color.FgRed, color.Underline).Println("Probable breaking changes:")
+	for _, change := range breaking {
+		color.New(color.FgRed).Printf("     ‼ %s\n", change)
+	}
+}
+
+// runPreCommitHook runs the repository pre-commit hook, if any, and offers to
+// re-stage the staged files it rewrote (e.g. formatters), so the analyzed
+// diff matches what ends up being committed. They are re-staged without
+// asking when not interactive. Only files that were fully staged before the
+// hook ran are re-staged, since re-staging the others would also stage
+// changes left out on purpose, e.g. hunks not picked with `--interactive`.
+// Files the hook deleted are left staged as they were.
+func (r *RootUsecase) runPreCommitHook(interactive bool) error {
+	hasHook, _ := r.gitService.HasPreCommitHook()
+	if !hasHook {
+		return nil
+	}
+
+	hookPath, _ := r.gitService.PreCommitHookPath()
+	if !r.gitService.IsExecutable(hookPath) {
+		return nil
+	}
+
+	stagedFiles, err := r.gitService.StagedFiles()
+	if err != nil {
+		return err
+	}
+
+	hashesBefore, err := r.gitService.HashWorkingTreeFiles(stagedFiles)
+	if err != nil {
+		return err
+	}
+
+	indexHashes, err := r.gitService.IndexHashes(stagedFiles)
+	if err != nil {
+		return err
+	}
+
+	color.New(color.FgGreen).Println("✔ Running pre-commit hook...")
+	if err := r.gitService.RunPreCommitHook(hookPath); err != nil {
+		color.New(color.FgRed).Printf("Pre-commit hook failed: %v\n", err)
+		return err
+	}
+	color.New(color.FgGreen).Println("✔ Pre-commit hook ran successfully.")
+
+	hashesAfter, err := r.gitService.HashWorkingTreeFiles(stagedFiles)
+	if err != nil {
+		return err
+	}
+
+	var modifiedFiles, partiallyStagedFiles, deletedFiles []string
+	for _, file := range stagedFiles {
+		before, after := hashesBefore[file], hashesAfter[file]
+		switch {
+		case before == after:
+		case after == "":
+			deletedFiles = append(deletedFiles, file)
+		case before != indexHashes[file]:
+			partiallyStagedFiles = append(partiallyStagedFiles, file)
+		default:
+			modifiedFiles = append(modifiedFiles, file)
+		}
+	}
+
+	if len(deletedFiles) > 0 {
+		color.New(color.FgYellow).Println("The pre-commit hook deleted staged files, which stay staged as they were:")
+		for _, file := range deletedFiles {
+			color.New(color.Bold).Printf("     - %s\n", file)
+		}
+	}
+	if len(partiallyStagedFiles) > 0 {
+		color.New(color.FgYellow).Println(
+			"The pre-commit hook modified partially staged files, which are not re-staged to keep their unstaged changes out:",
+		)
+		for _, file := range partiallyStagedFiles {
+			color.New(color.Bold).Printf("     - %s\n", file)
+		}
+	}
+
+	if len(modifiedFiles) == 0 {
+		return nil
+	}
+
+	color.New(color.FgYellow).Println("The pre-commit hook modified staged files:")
+	for _, file := range modifiedFiles {
+		color.New(color.Bold).Printf("     - %s\n", file)
+	}
+
+	restage := true
+	if interactive {
+		if err := huh.NewConfirm().
+			Title("Re-stage the modified files?").
+			Affirmative("Yes").
+			Negative("No").
+			Value(&restage).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run(); err != nil {
+			return err
+		}
+	}
+
+	if !restage {
+		color.New(color.Italic).Println("Leaving hook changes unstaged.")
+		return nil
+	}
+
+	if err := r.gitService.StageFiles(modifiedFiles); err != nil {
+		return err
 	}
+	color.New(color.FgGreen).Println("✔ Re-staged files modified by the pre-commit hook.")
 
 	return nil
 }
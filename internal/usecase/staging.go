@@ -0,0 +1,342 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/fatih/color"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+// stagingRow is a line of the staging list: a file, or one of its hunks when
+// hunk is not -1.
+type stagingRow struct {
+	file int
+	hunk int
+}
+
+// stagingModel lets the user pick the unstaged files and hunks to stage.
+type stagingModel struct {
+	files []service.UnstagedFile
+	// selected holds, for each file, whether each of its hunks is selected.
+	// Files staged as a whole have a single entry.
+	selected  [][]bool
+	rows      []stagingRow
+	cursor    int
+	preview   viewport.Model
+	ready     bool
+	confirmed bool
+	width     int
+	height    int
+}
+
+var (
+	stagingTitleStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#F780E2")).Bold(true).Padding(0, 0, 1, 0)
+	stagingCursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F780E2")).Bold(true)
+	stagingHintStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#666")).Italic(true).Padding(1, 0, 0, 0)
+	addedLineStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+	removedLineStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+	hunkHeaderStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#61AFEF"))
+)
+
+func newStagingModel(files []service.UnstagedFile) *stagingModel {
+	m := &stagingModel{files: files}
+	for i, file := range files {
+		m.rows = append(m.rows, stagingRow{i, -1})
+		if len(file.Hunks) > 1 {
+			m.selected = append(m.selected, make([]bool, len(file.Hunks)))
+			for j := range file.Hunks {
+				m.rows = append(m.rows, stagingRow{i, j})
+			}
+		} else {
+			m.selected = append(m.selected, make([]bool, 1))
+		}
+	}
+
+	return m
+}
+
+func (m *stagingModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *stagingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc", "q":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.rows)-1 {
+				m.cursor++
+			}
+		case " ", "x":
+			m.toggle(m.rows[m.cursor])
+		case "a":
+			m.toggleAll()
+		case "pgup":
+			m.preview.HalfViewUp()
+			return m, nil
+		case "pgdown":
+			m.preview.HalfViewDown()
+			return m, nil
+		case "enter":
+			m.confirmed = true
+			return m, tea.Quit
+		}
+		m.updatePreview()
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		previewHeight := max(msg.Height-m.listHeight()-8, 3)
+		if !m.ready {
+			m.preview = viewport.New(msg.Width-4, previewHeight)
+			m.ready = true
+		} else {
+			m.preview.Width, m.preview.Height = msg.Width-4, previewHeight
+		}
+		m.updatePreview()
+	}
+
+	return m, nil
+}
+
+// toggle flips the hunk of row. On a file row, it selects every hunk of the
+// file, or clears them when they all are selected already.
+func (m *stagingModel) toggle(row stagingRow) {
+	selected := m.selected[row.file]
+	if row.hunk != -1 {
+		selected[row.hunk] = !selected[row.hunk]
+		return
+	}
+
+	all := m.fileState(row.file) == stagingAll
+	for i := range selected {
+		selected[i] = !all
+	}
+}
+
+func (m *stagingModel) toggleAll() {
+	all := true
+	for i := range m.files {
+		all = all && m.fileState(i) == stagingAll
+	}
+
+	for _, selected := range m.selected {
+		for i := range selected {
+			selected[i] = !all
+		}
+	}
+}
+
+type stagingState int
+
+const (
+	stagingNone stagingState = iota
+	stagingPartial
+	stagingAll
+)
+
+func (m *stagingModel) fileState(file int) stagingState {
+	count := 0
+	for _, selected := range m.selected[file] {
+		if selected {
+			count++
+		}
+	}
+
+	switch count {
+	case 0:
+		return stagingNone
+	case len(m.selected[file]):
+		return stagingAll
+	default:
+		return stagingPartial
+	}
+}
+
+// listHeight is how many rows of the list are shown at once.
+func (m *stagingModel) listHeight() int {
+	return min(len(m.rows), max(m.height/2, 5))
+}
+
+func (m *stagingModel) updatePreview() {
+	if !m.ready {
+		return
+	}
+
+	row := m.rows[m.cursor]
+	file := m.files[row.file]
+
+	var content string
+	switch {
+	case file.Status == service.StatusAdded:
+		content = "Untracked file, staged as a whole."
+	case file.Status == service.StatusDeleted:
+		content = "Deleted file, staged as a whole."
+	case file.Binary:
+		content = "Binary file, staged as a whole."
+	case len(file.Hunks) == 0:
+		content = "Mode change, staged as a whole."
+	case row.hunk != -1:
+		content = renderHunk(file.Hunks[row.hunk])
+	default:
+		hunks := make([]string, 0, len(file.Hunks))
+		for _, hunk := range file.Hunks {
+			hunks = append(hunks, renderHunk(hunk))
+		}
+		content = strings.Join(hunks, "\n")
+	}
+
+	m.preview.SetContent(content)
+	m.preview.GotoTop()
+}
+
+func renderHunk(hunk service.Hunk) string {
+	lines := []string{hunkHeaderStyle.Render(hunk.Header)}
+	for _, line := range hunk.Lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			line = addedLineStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = removedLineStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *stagingModel) View() string {
+	if !m.ready {
+		return "\n  Initializing..."
+	}
+
+	// Scroll the list so the cursor stays visible
+	height := m.listHeight()
+	first := min(max(m.cursor-height/2, 0), len(m.rows)-height)
+
+	var list strings.Builder
+	for i := first; i < first+height; i++ {
+		row := m.rows[i]
+		file := m.files[row.file]
+
+		var line string
+		if row.hunk == -1 {
+			var checkbox string
+			switch m.fileState(row.file) {
+			case stagingAll:
+				checkbox = "[x]"
+			case stagingPartial:
+				checkbox = "[~]"
+			default:
+				checkbox = "[ ]"
+			}
+			line = fmt.Sprintf("%s %s %s", checkbox, stagingStatusLabel(file.Status), file.Path)
+		} else {
+			checkbox := "[ ]"
+			if m.selected[row.file][row.hunk] {
+				checkbox = "[x]"
+			}
+			line = fmt.Sprintf("    %s %s", checkbox, file.Hunks[row.hunk].Header)
+		}
+
+		if i == m.cursor {
+			list.WriteString(stagingCursorStyle.Render("> "+line) + "\n")
+		} else {
+			list.WriteString("  " + line + "\n")
+		}
+	}
+
+	previewStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#555")).
+		Padding(0, 1)
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		stagingTitleStyle.Render("Select the changes to stage:"),
+		strings.TrimSuffix(list.String(), "\n"),
+		previewStyle.Render(m.preview.View()),
+		stagingHintStyle.Render(
+			"↑/↓ to navigate • Space to toggle • a to toggle all • PgUp/PgDn to scroll the diff • Enter to stage • Esc to skip",
+		),
+	)
+}
+
+func stagingStatusLabel(status service.ChangeStatus) string {
+	switch status {
+	case service.StatusAdded:
+		return "new     "
+	case service.StatusDeleted:
+		return "deleted "
+	default:
+		return "modified"
+	}
+}
+
+// selection returns the files to stage as a whole and the hunks to stage of
+// the partially selected ones.
+func (m *stagingModel) selection() ([]string, map[string][]service.Hunk) {
+	var whole []string
+	partial := make(map[string][]service.Hunk)
+	for i, file := range m.files {
+		switch m.fileState(i) {
+		case stagingAll:
+			whole = append(whole, file.Path)
+		case stagingPartial:
+			for j, selected := range m.selected[i] {
+				if selected {
+					partial[file.Path] = append(partial[file.Path], file.Hunks[j])
+				}
+			}
+		}
+	}
+
+	return whole, partial
+}
+
+// stageInteractively lets the user pick the unstaged files, untracked ones
+// included, and hunks to stage before the message is generated.
+func (r *RootUsecase) stageInteractively() error {
+	files, err := r.gitService.UnstagedChanges()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		color.New(color.FgYellow).Println("No unstaged changes to pick from.")
+		return nil
+	}
+
+	model := newStagingModel(files)
+	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("failed to run the staging screen. %v", err)
+	}
+	if !model.confirmed {
+		return nil
+	}
+
+	whole, partial := model.selection()
+	if err := r.gitService.StageFiles(whole); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := r.gitService.StageHunks(file.Path, partial[file.Path]); err != nil {
+			return err
+		}
+	}
+
+	if staged := len(whole) + len(partial); staged > 0 {
+		color.New(color.FgGreen).Printf("✔ Staged changes of %d files\n", staged)
+	}
+
+	return nil
+}
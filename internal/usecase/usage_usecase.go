@@ -0,0 +1,166 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+
+	"github.com/tfkhdyt/geminicommit/internal/service"
+)
+
+// Values of the `usage --by` flag.
+const (
+	usageByDay   = "day"
+	usageByRepo  = "repo"
+	usageByModel = "model"
+)
+
+type UsageUsecase struct {
+	usageService *service.UsageService
+}
+
+func NewUsageUsecase(usageService *service.UsageService) *UsageUsecase {
+	return &UsageUsecase{usageService}
+}
+
+// usageTotal sums the records of a report row.
+type usageTotal struct {
+	key      string
+	requests int
+	service.TokenUsage
+	cost float64
+	// unpriced tells whether some records have no configured price.
+	unpriced bool
+}
+
+func (t *usageTotal) add(record service.UsageRecord, pricing map[string]service.ModelPricing) {
+	t.requests++
+	t.PromptTokens += record.PromptTokens
+	t.ResponseTokens += record.ResponseTokens
+
+	if price, ok := pricing[record.Model]; ok {
+		t.cost += price.Cost(record.TokenUsage)
+	} else {
+		t.unpriced = true
+	}
+}
+
+// UsageCommand prints the token usage and cost of the last days (every
+// record when days is 0), grouped by day, repository or model.
+func (u *UsageUsecase) UsageCommand(groupBy string, days int) error {
+	var keyOf func(service.UsageRecord) string
+	switch groupBy {
+	case usageByDay:
+		keyOf = func(record service.UsageRecord) string {
+			return record.Timestamp.Local().Format("2006-01-02")
+		}
+	case usageByRepo:
+		keyOf = func(record service.UsageRecord) string {
+			// Patches used to be recorded without a repository
+			if record.Repo == "" {
+				return service.PatchUsageRepo
+			}
+			return record.Repo
+		}
+	case usageByModel:
+		keyOf = func(record service.UsageRecord) string { return record.Model }
+	default:
+		return fmt.Errorf(
+			"invalid grouping %q. expected %s, %s or %s",
+			groupBy,
+			usageByDay,
+			usageByRepo,
+			usageByModel,
+		)
+	}
+
+	pricing, err := service.Pricing()
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if days > 0 {
+		year, month, day := time.Now().AddDate(0, 0, -days+1).Date()
+		since = time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	}
+
+	records, err := u.usageService.Records(since)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		color.New(color.FgYellow).Println("No usage recorded yet.")
+		return nil
+	}
+
+	totals := make(map[string]*usageTotal)
+	total := &usageTotal{key: "TOTAL"}
+	var unpricedModels []string
+	for _, record := range records {
+		key := keyOf(record)
+		if totals[key] == nil {
+			totals[key] = &usageTotal{key: key}
+		}
+		totals[key].add(record, pricing)
+		total.add(record, pricing)
+
+		if _, ok := pricing[record.Model]; !ok && !slices.Contains(unpricedModels, record.Model) {
+			unpricedModels = append(unpricedModels, record.Model)
+		}
+	}
+
+	rows := make([]*usageTotal, 0, len(totals))
+	for _, row := range totals {
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b *usageTotal) int {
+		if groupBy == usageByDay {
+			return strings.Compare(a.key, b.key)
+		}
+		return b.Total() - a.Total()
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT TOKENS\tRESPONSE TOKENS\tCOST\n", strings.ToUpper(groupBy))
+	for _, row := range append(rows, total) {
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%s\t%s\t%s\n",
+			row.key,
+			row.requests,
+			humanize.Comma(int64(row.PromptTokens)),
+			humanize.Comma(int64(row.ResponseTokens)),
+			formatCost(row),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(unpricedModels) > 0 {
+		fmt.Print("\n")
+		color.New(color.Italic).Printf(
+			"* no pricing configured for %s, add them to the pricing list of the config file\n",
+			strings.Join(unpricedModels, ", "),
+		)
+	}
+
+	return nil
+}
+
+func formatCost(row *usageTotal) string {
+	cost := fmt.Sprintf("%.4f", row.cost)
+	if row.unpriced {
+		cost += "*"
+	}
+
+	return cost
+}